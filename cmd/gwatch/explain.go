@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/huboh/gwatch/internal/pkg/config"
+	"github.com/huboh/gwatch/internal/pkg/watcher"
+)
+
+// explain prints the resolved watch set, and whether each of the paths is watched along with the rule that decided it.
+func explain(cfg config.Config, paths []string) {
+	configs, err := watcher.NewConfigs(cfg)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("root: %s\n", configs.RootDir)
+	fmt.Printf("backend: %s\n", configs.Backend)
+	fmt.Printf("source: %s\n", configs.Source)
+	fmt.Printf("exts: %s\n", strings.Join(configs.Exts, ", "))
+	fmt.Printf("include: %s\n", strings.Join(configs.Include, ", "))
+	fmt.Printf("exclude: %s\n", strings.Join(configs.Exclude, ", "))
+	fmt.Printf("editor ignore: %s\n", strings.Join(configs.EditorIgnore, ", "))
+	fmt.Printf("ignore files: %v\n", configs.IgnoreFiles)
+
+	if len(configs.LocalModules) > 0 {
+		fmt.Printf("local modules: %s\n", strings.Join(relPaths(configs.RootDir, configs.LocalModules), ", "))
+	}
+
+	if len(configs.Files) > 0 {
+		fmt.Printf("files: %s\n", strings.Join(relPaths(configs.RootDir, configs.Files), ", "))
+	}
+
+	fmt.Printf("directories (%d):\n", len(configs.Paths))
+
+	for _, dir := range relPaths(configs.RootDir, configs.Paths) {
+		fmt.Printf("  %s\n", dir)
+	}
+
+	for _, p := range paths {
+		fmt.Println(configs.Explain(p))
+	}
+}
+
+// relPaths returns the paths relative to the root directory, when possible.
+func relPaths(root string, paths []string) []string {
+	rels := make([]string, len(paths))
+
+	for i, p := range paths {
+		rels[i] = p
+
+		if rel, err := filepath.Rel(root, p); err == nil {
+			rels[i] = rel
+		}
+	}
+
+	return rels
+}
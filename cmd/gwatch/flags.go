@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/huboh/gwatch/internal/pkg/config"
+	"github.com/huboh/gwatch/internal/pkg/watcher"
+)
+
+var (
+	// backendFlag overrides the watcher backend set in the config file
+	backendFlag = flag.String("backend", "", "watcher backend, one of fsnotify, poll or auto. overrides the config file")
+
+	// traceEventsFlag enables logging every watcher event along with the filter decision made for it
+	traceEventsFlag = flag.Bool("trace-events", false, "log every watcher event along with the filter decision made for it")
+
+	// recordFlag is the file the raw watcher events are recorded to
+	recordFlag = flag.String("record", "", "record the raw watcher events to the file, to replay them later")
+
+	// replayFlag is the recorded session replayed instead of watching the disk
+	replayFlag = flag.String("replay", "", "replay the events recorded to the file instead of watching the disk")
+)
+
+// applyFlags overrides the config values with the ones set from the command line flags.
+func applyFlags(cfg *config.Config) {
+	if *backendFlag != "" {
+		cfg.Backend = *backendFlag
+	}
+}
+
+// applyWatcherFlags sets the watcher configs only set from the command line flags.
+func applyWatcherFlags(configs *watcher.Configs) {
+	configs.RecordFile = *recordFlag
+	configs.ReplayFile = *replayFlag
+}
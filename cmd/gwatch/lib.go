@@ -2,6 +2,9 @@ package main
 
 import (
 	"log"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -18,9 +21,7 @@ type Gwatch struct {
 }
 
 func (g *Gwatch) Kill() {
-	if err := g.runner.Kill(); err != nil {
-		log.Fatal(err)
-	}
+	g.runner.Stop()
 
 	if err := g.fsWatcher.Close(); err != nil {
 		log.Fatal(err)
@@ -29,6 +30,8 @@ func (g *Gwatch) Kill() {
 
 func (g *Gwatch) Start() error {
 	clrLog := logger.New().Runner()
+	errLog := logger.New().Error()
+	warnLog := logger.New().Warning()
 
 	onBuild := func() {
 		clrLog("Building...")
@@ -36,23 +39,111 @@ func (g *Gwatch) Start() error {
 
 	onRunBuild := func() {
 		clrLog("Running...")
+
+		// the build succeeded, remember the content it was built from
+		if err := g.fsWatcher.Fingerprints().Save(); err != nil {
+			clrLog("error saving files fingerprints: %s", err)
+		}
 	}
 
+	g.runner.OnStop(func(r runner.StopReport) {
+		name := r.Process
+
+		if name == "" {
+			name = "app"
+		}
+
+		clrLog("%s %s", name, r)
+	})
+
+	// the processes exiting on their own are reported, as errors if they failed
+	g.runner.OnExit(func(r runner.ExitReport) {
+		name := r.Process
+
+		if name == "" {
+			name = "app"
+		}
+
+		if r.Err != nil {
+			errLog("%s %s", name, r)
+		} else {
+			clrLog("%s %s", name, r)
+		}
+	})
+
+	// the failures of the steps are reported as errors if they abort the launch, as warnings if their policy is to warn
+	g.runner.OnStep(func(r runner.StepReport) {
+		switch {
+		case r.Err != nil && r.OnFailure == runner.FailureAbort:
+			errLog("%s", r)
+
+		case r.Err != nil && r.OnFailure == runner.FailureWarn:
+			warnLog("warning: %s", r)
+
+		default:
+			clrLog("%s", r)
+		}
+	})
+
 	g.fsWatcher.OnError(func(e error) {
 		log.Fatal("watcher error", e)
 	})
 
-	g.fsWatcher.OnEvent(watcher.WriteEvent, func(e watcher.Event) {
-		if err := g.runner.Launch(onBuild, onRunBuild); err != nil {
+	g.fsWatcher.OnWarning(func(e error) {
+		warnLog("warning: %s", e)
+	})
+
+	if *traceEventsFlag {
+		g.fsWatcher.OnTrace(func(e watcher.Event, decision string) {
+			clrLog("trace: %s %s: %s", strings.ToLower(e.Type.String()), e.Path, decision)
+		})
+	}
+
+	g.fsWatcher.OnGitOperation(func(running bool) {
+		if running {
+			clrLog("git operation in progress, holding rebuilds")
+		} else {
+			clrLog("git operation finished")
+		}
+	})
+
+	// rebuild once for all the files written, created, deleted or renamed in between debounced calls
+	g.fsWatcher.OnBatch(func(b watcher.Batch) {
+		logChanges(clrLog, b)
+
+		if err := g.runner.Launch(b.Paths(), onBuild, onRunBuild); err != nil {
 			log.Fatal(err)
 		}
 	})
 
 	g.fsWatcher.Listen(func(configs watcher.Configs) {
-		clrLog("watching path(s): %s", strings.Join(configs.RootPaths, ","))
+		clrLog("watching path(s): %s", strings.Join(slices.Concat(configs.RootPaths, configs.LocalModules), ","))
 		clrLog("watching extension(s): %s", strings.Join(configs.Exts, ","))
 
-		if err := g.runner.Launch(onBuild, onRunBuild); err != nil {
+		for _, warning := range configs.Warnings {
+			warnLog("warning: %s", warning)
+		}
+
+		if limitErr := g.fsWatcher.LimitErr(); limitErr != nil {
+			clrLog("%s, polling the remaining %d directories", limitErr, limitErr.Needed-limitErr.Watched)
+		}
+
+		if g.fsWatcher.GitOperationRunning() {
+			clrLog("git operation in progress, holding rebuilds")
+		}
+
+		// skip the first build if nothing changed since the last one
+		if g.fsWatcher.Fingerprints().Unchanged() && g.runner.HasBuild() {
+			clrLog("no changes since last build, skipping build")
+
+			if err := g.runner.RunBuild(onRunBuild); err != nil {
+				log.Fatal(err)
+			}
+
+			return
+		}
+
+		if err := g.runner.Launch(nil, onBuild, onRunBuild); err != nil {
 			log.Fatal(err)
 		}
 	})
@@ -60,7 +151,29 @@ func (g *Gwatch) Start() error {
 	return nil
 }
 
-func watchConfigFile(onChange func()) {
+// logChanges logs the changed paths of the batch, a large batch is summarized.
+func logChanges(clrLog logger.LogFunc, b watcher.Batch) {
+	const maxLogged = 5
+
+	cwd, _ := os.Getwd()
+
+	for i, e := range b {
+		if i == maxLogged {
+			clrLog("and %d more change(s)", len(b)-maxLogged)
+			break
+		}
+
+		path := e.Path
+
+		if rel, err := filepath.Rel(cwd, e.Path); err == nil {
+			path = rel
+		}
+
+		clrLog("%s: %s", strings.ToLower(e.Type.String()), path)
+	}
+}
+
+func watchConfigFile(backend string, onChange func()) {
 	cfg := config.Default()
 
 	// setup config for config file on a copy of app config
@@ -68,10 +181,11 @@ func watchConfigFile(onChange func()) {
 	cfg.Paths = []string{config.ConfigPath}
 	cfg.Delay = time.Millisecond * 100
 	cfg.Recursive = false
+	cfg.Backend = backend
 
 	// new watcher for config file
 	cfgWatcher := utils.Must(
-		watcher.New(watcher.NewConfigs(*cfg)),
+		watcher.New(utils.Must(watcher.NewConfigs(*cfg))),
 	)
 
 	cfgWatcher.OnEvent(watcher.WriteEvent, func(e watcher.Event) {
@@ -1,50 +1,155 @@
-package main
-
-import (
-	"log"
-
-	"github.com/huboh/gwatch/internal/pkg/config"
-	"github.com/huboh/gwatch/internal/pkg/logger"
-	"github.com/huboh/gwatch/internal/pkg/runner"
-	"github.com/huboh/gwatch/internal/pkg/utils"
-	"github.com/huboh/gwatch/internal/pkg/watcher"
-)
-
-func main() {
-	done := make(chan struct{})
-	clrLog := logger.New().Watcher()
-	gwatchCfg := utils.Must(config.New())
-
-	go func() {
-		for {
-			gwatch := &Gwatch{
-				runner:    runner.New(*gwatchCfg),
-				fsWatcher: utils.Must(watcher.New(watcher.NewConfigs(*gwatchCfg))),
-			}
-
-			select {
-			// kill gwatch
-			case <-done:
-				gwatch.Kill()
-
-				// reset channel so we don't close a closed channel
-				done = make(chan struct{})
-
-			// start gwatch
-			case <-utils.AsyncResult(gwatch.Start):
-			}
-		}
-	}()
-
-	watchConfigFile(func() {
-		// signal gwatch to restart.
-		defer utils.CloseSafely(done)
-
-		// reload gwatch config
-		if err := gwatchCfg.Reload(); err != nil {
-			log.Fatal("error reloading gwatch config: ", err)
-		}
-
-		clrLog("restarting gwatch due to changes to config file")
-	})
-}
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/huboh/gwatch/internal/pkg/config"
+	"github.com/huboh/gwatch/internal/pkg/logger"
+	"github.com/huboh/gwatch/internal/pkg/runner"
+	"github.com/huboh/gwatch/internal/pkg/utils"
+	"github.com/huboh/gwatch/internal/pkg/watcher"
+)
+
+func main() {
+	flag.Parse()
+
+	done := make(chan struct{})
+	clrLog := logger.New().Watcher()
+	gwatchCfg := utils.Must(config.New())
+
+	applyFlags(gwatchCfg)
+
+	// explain what is watched and why, then exit
+	if flag.Arg(0) == "explain" {
+		explain(*gwatchCfg, flag.Args()[1:])
+		return
+	}
+
+	pauses := pauseRequests()
+
+	// paused is whether gwatch was paused when it restarted, the new watcher is paused too
+	paused := false
+
+	// recordStart is when the session recorded with the record flag started, the new watcher appends to it
+	var recordStart time.Time
+
+	// the commands run in their own process group, so they no longer receive the terminal's interrupts
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		for {
+			configs, err := watcher.NewConfigs(*gwatchCfg)
+
+			// wait for the config file to be fixed
+			if err != nil {
+				clrLog("%s, waiting for changes to the config file", err)
+
+				select {
+				case <-done:
+					done = make(chan struct{})
+					continue
+
+				case sig := <-interrupts:
+					os.Exit(exitCode(sig))
+				}
+			}
+
+			applyWatcherFlags(configs)
+			configs.RecordStart = recordStart
+
+			fsWatcher, err := watcher.New(configs)
+
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			recordStart = configs.RecordStart
+
+			gwatchRunner, err := runner.New(*gwatchCfg)
+
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			gwatch := &Gwatch{
+				runner:    gwatchRunner,
+				fsWatcher: fsWatcher,
+			}
+
+			if paused {
+				fsWatcher.Pause()
+				clrLog("still paused, changes are collected until resumed")
+			}
+
+			started := utils.AsyncResult(gwatch.Start)
+
+		running:
+			for {
+				select {
+				// kill gwatch
+				case <-done:
+					paused = fsWatcher.Paused()
+					gwatch.Kill()
+
+					// reset channel so we don't close a closed channel
+					done = make(chan struct{})
+					break running
+
+				// start gwatch
+				case <-started:
+					break running
+
+				// pause or resume gwatch
+				case <-pauses:
+					gwatch.TogglePause()
+
+				// stop the app before exiting, a second interrupt kills it right away
+				case sig := <-interrupts:
+					go func() {
+						sig := <-interrupts
+
+						clrLog("killing the app")
+
+						if err := gwatchRunner.Kill(); err != nil {
+							log.Println(err)
+						}
+
+						os.Exit(exitCode(sig))
+					}()
+
+					gwatch.Kill()
+					os.Exit(exitCode(sig))
+				}
+			}
+		}
+	}()
+
+	watchConfigFile(gwatchCfg.Backend, func() {
+		// signal gwatch to restart.
+		defer utils.CloseSafely(done)
+
+		// reload gwatch config
+		if err := gwatchCfg.Reload(); err != nil {
+			log.Fatal("error reloading gwatch config: ", err)
+		}
+
+		applyFlags(gwatchCfg)
+
+		clrLog("restarting gwatch due to changes to config file")
+	})
+}
+
+// exitCode returns the exit status of gwatch once terminated by the signal, 128 + the signal number like the shells.
+func exitCode(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+
+	return 1
+}
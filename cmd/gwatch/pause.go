@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"github.com/huboh/gwatch/internal/pkg/logger"
+)
+
+// TogglePause pauses the rebuilds if they're running, and resumes them otherwise.
+// while paused, the changes are collected, and a single rebuild runs on resume if any file changed.
+func (g *Gwatch) TogglePause() {
+	clrLog := logger.New().Watcher()
+
+	if g.fsWatcher.Paused() {
+		g.fsWatcher.Resume()
+		clrLog("resumed watching")
+
+		return
+	}
+
+	g.fsWatcher.Pause()
+
+	if isTerminal(os.Stdin) {
+		clrLog("paused watching, changes are collected until resumed. press p & enter to resume")
+	} else {
+		clrLog("paused watching, changes are collected until resumed")
+	}
+}
+
+// isTerminal reports whether the file is an interactive terminal.
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// pauseRequests returns the channel receiving the requests to toggle the pause,
+// from the terminal by typing `p` & enter, and from the pause signal (SIGUSR1 on unix).
+func pauseRequests() <-chan struct{} {
+	requests := make(chan struct{})
+
+	notifyPauseSignal(requests)
+
+	// only read from an interactive terminal
+	if isTerminal(os.Stdin) {
+		go func() {
+			scanner := bufio.NewScanner(os.Stdin)
+
+			for scanner.Scan() {
+				if strings.TrimSpace(scanner.Text()) == "p" {
+					requests <- struct{}{}
+				}
+			}
+		}()
+	}
+
+	return requests
+}
@@ -0,0 +1,6 @@
+//go:build !unix
+
+package main
+
+// notifyPauseSignal does nothing, there is no pause signal on this os.
+func notifyPauseSignal(requests chan<- struct{}) {}
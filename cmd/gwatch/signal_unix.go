@@ -0,0 +1,22 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyPauseSignal sends a pause request to requests on each SIGUSR1, e.g `kill -USR1 <gwatch pid>`.
+func notifyPauseSignal(requests chan<- struct{}) {
+	signals := make(chan os.Signal, 1)
+
+	signal.Notify(signals, syscall.SIGUSR1)
+
+	go func() {
+		for range signals {
+			requests <- struct{}{}
+		}
+	}()
+}
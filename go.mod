@@ -3,8 +3,10 @@ module github.com/huboh/gwatch
 go 1.22.3
 
 require (
+	github.com/bmatcuk/doublestar/v4 v4.6.1
 	github.com/fatih/color v1.17.0
 	github.com/fsnotify/fsnotify v1.7.0
+	golang.org/x/mod v0.20.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
@@ -1,186 +1,452 @@
-// Package config provides functionality loading & writing our app config.
-package config
-
-import (
-	"fmt"
-	"os"
-	"path/filepath"
-	"time"
-
-	"github.com/huboh/gwatch/internal/pkg/utils"
-	"gopkg.in/yaml.v3"
-)
-
-var (
-	// rootDir is the current working directory
-	rootDir = utils.Must(os.Getwd())
-
-	// configName is our configuration file name
-	configName = "gwatch.yml"
-
-	// ConfigPath is path to our configuration file
-	ConfigPath = filepath.Join(rootDir, configName)
-
-	// defaultExts defines the default file extensions to watch for changes.
-	defaultExts = []string{"go", "tmp", "tmpl", "html"}
-
-	// defaultPaths defines the default paths to watch for changes.
-	defaultPaths = []string{rootDir}
-
-	// defaultExclude defines the default directories to exclude from watching.
-	defaultExclude = []string{".git", "bin", "vendor", "testdata"}
-
-	// defaultRecursive defines whether to watch directories listed in `defaultPaths` recursively.
-	defaultRecursive = true
-
-	// defaultBuildCmd is the command used to build the project.
-	defaultBuildCmd = fmt.Sprintf("go build -o %s %s", defaultBinPath, rootDir)
-
-	// defaultDelayMs is the watcher delay in between events
-	defaultDelay = time.Millisecond * 100
-
-	// defaultLogPrefix is the prefix added to runner stderr/stdout output
-	defaultLogPrefix = filepath.Base(rootDir)
-)
-
-// Config represents the app's
-type Config struct {
-	// watcher config
-	Root      string        `yaml:"root"`
-	Exts      []string      `yaml:"exts,flow"`
-	Paths     []string      `yaml:"paths,flow"`
-	Exclude   []string      `yaml:"exclude,flow"`
-	Delay     time.Duration `yaml:"delay"`
-	Recursive bool          `yaml:"recursive"`
-
-	// runner config
-	LogPrefix string      `yaml:"log_prefix"`
-	Run       RunConfig   `yaml:"run"`
-	Build     BuildConfig `yaml:"build"`
-}
-
-// Run represents the run configuration for the runner.
-type RunConfig struct {
-	// Bin is the binary to be executed.
-	Bin string `yaml:"bin"`
-
-	// Args are the arguments to be passed to the binary.
-	Args []string `yaml:"args,flow"`
-}
-
-// Build represents the build configuration for the runner.
-type BuildConfig struct {
-	// Cmd is the build command to be executed.
-	Cmd string `yaml:"cmd"`
-}
-
-// New reads the config file in the root directory and returns it.
-// If the config file does not exist, it creates a new config file with the defaults and returns it.
-//
-// The config file is expected to be in YAML format.
-//
-// It returns a pointer to a Config and an error. If successful, the error is nil.
-func New() (*Config, error) {
-	var (
-		config  = Default()
-		loadErr error
-	)
-
-	defer func() {
-		if val := recover(); val != nil {
-			if err, ok := val.(error); ok {
-				loadErr = fmt.Errorf("error loading config file: %w", err)
-			}
-		}
-	}()
-
-	// if config file don't exists create new one and write our defaults to it, then return it.
-	if _, err := os.Stat(ConfigPath); err != nil {
-		if !os.IsNotExist(err) {
-			return nil, err
-		}
-
-		if err := createAndWriteConfigFile(ConfigPath, *config); err != nil {
-			return nil, err
-		}
-
-		return config, nil
-	}
-
-	// read config file and merge it with our defaults, then return it.
-	byts, err := os.ReadFile(ConfigPath)
-
-	if err != nil {
-		return nil, err
-	}
-
-	if err = yaml.Unmarshal(byts, config); err != nil {
-		return nil, err
-	}
-
-	return config, loadErr
-}
-
-// Default returns a pointer to a new Config initialized with the default values.
-func Default() *Config {
-	return &Config{
-		Root:      rootDir,
-		Exts:      defaultExts,
-		Paths:     defaultPaths,
-		Exclude:   defaultExclude,
-		Delay:     defaultDelay,
-		Recursive: defaultRecursive,
-		LogPrefix: defaultLogPrefix,
-
-		Run: RunConfig{
-			Bin:  defaultBinPath,
-			Args: []string{},
-		},
-
-		Build: BuildConfig{
-			Cmd: defaultBuildCmd,
-		},
-	}
-}
-
-// createAndWriteConfigFile creates a new config file at the specified path and writes the provided config to it.
-//
-// Returns an error if the file creation or writing process fails.
-func createAndWriteConfigFile(path string, config Config) error {
-	file, err := os.Create(path)
-
-	if err != nil {
-		return fmt.Errorf("error creating config file: %w", err)
-	}
-
-	defer file.Close()
-
-	// write config to file
-	// yaml.
-	if err := yaml.NewEncoder(file).Encode(config); err != nil {
-
-		// delete the new config file incase of write error
-		if err := os.Remove(path); err != nil {
-			return fmt.Errorf("error deleting config file after write failure: %w", err)
-		}
-
-		return fmt.Errorf("error writing new config file: %w", err)
-	}
-
-	return nil
-}
-
-// Reload reloads the configuration from the config file, updating the current Config instance.
-//
-// It reads the config file from the root directory and updates the fields of the current Config instance.
-//
-// Returns an error if there was an issue reading or parsing the config file.
-func (c *Config) Reload() error {
-	config, err := New()
-	if err != nil {
-		return err
-	}
-
-	*c = *config
-	return nil
-}
+// Package config provides functionality loading & writing our app config.
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/huboh/gwatch/internal/pkg/utils"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// rootDir is the current working directory
+	rootDir = utils.Must(os.Getwd())
+
+	// configName is our configuration file name
+	configName = "gwatch.yml"
+
+	// ConfigPath is path to our configuration file
+	ConfigPath = filepath.Join(rootDir, configName)
+
+	// stateDirName is the directory gwatch persists it's state to, relative to the root directory
+	stateDirName = ".gwatch"
+
+	// defaultExts defines the default file extensions to watch for changes.
+	defaultExts = []string{"go", "tmp", "tmpl", "html"}
+
+	// defaultPaths defines the default paths to watch for changes.
+	defaultPaths = []string{rootDir}
+
+	// defaultInclude defines the default glob patterns of files to watch in addition to `defaultExts`.
+	defaultInclude = []string{}
+
+	// defaultExclude defines the default glob patterns of directories and files to exclude from watching.
+	defaultExclude = []string{".git", ".gwatch", "bin", "vendor", "testdata"}
+
+	// defaultEditorIgnore defines the default glob patterns of the editors temporary, swap & backup files to exclude from watching:
+	// vim swap & `4913` probe files, emacs lock & auto-save files, jetbrains safe-write files and `~` backups.
+	defaultEditorIgnore = []string{"*.swp", "*.swo", "*.swx", "4913", ".#*", `\#*#`, "*~", "*___jb_tmp___", "*___jb_old___"}
+
+	// defaultIgnoreFiles defines whether to honor the .gitignore, .ignore & .gwatchignore files.
+	defaultIgnoreFiles = false
+
+	// defaultSource defines where the watch set is built from, one of "fs" or "git".
+	defaultSource = "fs"
+
+	// defaultRecursive defines whether to watch directories listed in `defaultPaths` recursively.
+	defaultRecursive = true
+
+	// defaultBuildCmd is the command used to build the project.
+	defaultBuildCmd = fmt.Sprintf("go build -o %s %s", defaultBinPath, rootDir)
+
+	// defaultDelayMs is the watcher delay in between events
+	defaultDelay = time.Millisecond * 100
+
+	// defaultDebounce defines when to run commands during a burst of changes, by default once the changes settled for `defaultDelay`.
+	defaultDebounce = DebounceConfig{Leading: false, Trailing: true, MaxWait: 0}
+
+	// defaultBackend is the watcher backend, one of "fsnotify", "poll" or "auto"
+	defaultBackend = "auto"
+
+	// defaultPollInterval is the interval in between scans of the polling watcher backend
+	defaultPollInterval = time.Millisecond * 500
+
+	// defaultSkipUnchanged defines whether to skip rebuilds when the content of the changed files did not change.
+	defaultSkipUnchanged = true
+
+	// defaultPersistFingerprints defines whether to persist the files content fingerprints to the state directory,
+	// so the first build after a restart is also skipped when nothing changed.
+	defaultPersistFingerprints = false
+
+	// defaultWatchDeps defines whether to only watch the go files of the packages in the build target's dependency closure.
+	defaultWatchDeps = false
+
+	// defaultDepsTarget is the package pattern of the build target, relative to the root directory.
+	defaultDepsTarget = "."
+
+	// defaultWatchLocalModules defines whether to watch the local modules of go.mod's replace directives & the go.work file.
+	defaultWatchLocalModules = true
+
+	// defaultFollowSymlinks defines whether to walk into the symbolic links to directories, watching their real directories.
+	defaultFollowSymlinks = false
+
+	// defaultHoldGitOperations defines whether to hold the rebuilds while a git operation like a checkout or a rebase runs.
+	defaultHoldGitOperations = true
+
+	// defaultGitLockTimeout is the time without changes after which an index lock is considered left over by a crashed git process.
+	defaultGitLockTimeout = time.Second * 30
+
+	// defaultStopSignal is the signal sent to the running binary to stop it before a rebuild.
+	defaultStopSignal = "SIGTERM"
+
+	// defaultStopTimeout is how long the running binary is given to exit after the stop signal, before it's killed.
+	defaultStopTimeout = time.Second * 5
+
+	// defaultLogPrefix is the prefix added to runner stderr/stdout output
+	defaultLogPrefix = filepath.Base(rootDir)
+)
+
+// Config represents the app's
+type Config struct {
+	// watcher config
+	Root         string         `yaml:"root"`
+	Exts         []string       `yaml:"exts,flow"`
+	Paths        []string       `yaml:"paths,flow"`
+	Include      []string       `yaml:"include,flow"`
+	Exclude      []string       `yaml:"exclude,flow"`
+	EditorIgnore []string       `yaml:"editor_ignore,flow"`
+	IgnoreFiles  bool           `yaml:"ignore_files"`
+	Source       string         `yaml:"source"`
+	Delay        time.Duration  `yaml:"delay"`
+	Recursive    bool           `yaml:"recursive"`
+	Debounce     DebounceConfig `yaml:"debounce"`
+
+	// symbolic links config
+	FollowSymlinks bool `yaml:"follow_symlinks"`
+
+	// watcher backend config
+	Backend      string        `yaml:"backend"`
+	PollInterval time.Duration `yaml:"poll_interval"`
+
+	// content fingerprints config
+	SkipUnchanged       bool `yaml:"skip_unchanged"`
+	PersistFingerprints bool `yaml:"persist_fingerprints"`
+
+	// dependency graph config
+	WatchDeps  bool   `yaml:"watch_deps"`
+	DepsTarget string `yaml:"deps_target"`
+
+	// local modules config
+	WatchLocalModules bool `yaml:"watch_local_modules"`
+
+	// git operations config
+	HoldGitOperations bool          `yaml:"hold_git_operations"`
+	GitLockTimeout    time.Duration `yaml:"git_lock_timeout"`
+
+	// runner config
+	LogPrefix string      `yaml:"log_prefix"`
+	Run       RunConfig   `yaml:"run"`
+	Build     BuildConfig `yaml:"build"`
+
+	// processes config
+	Processes []ProcessConfig `yaml:"processes,omitempty"`
+}
+
+// DebounceConfig represents the debouncing of the changes in between the watcher and the runner.
+type DebounceConfig struct {
+	// Leading runs the commands on the first change of a burst of changes.
+	Leading bool `yaml:"leading"`
+
+	// Trailing runs the commands once no change happened for the watcher delay.
+	Trailing bool `yaml:"trailing"`
+
+	// MaxWait is the maximum time a burst of changes can delay the commands, zero disables it.
+	MaxWait time.Duration `yaml:"max_wait"`
+}
+
+// Run represents the run configuration for the runner.
+type RunConfig struct {
+	// Bin is the binary to be executed.
+	Bin string `yaml:"bin"`
+
+	// Args are the arguments to be passed to the binary.
+	Args []string `yaml:"args,flow"`
+
+	// Shell runs the binary & it's arguments through the shell, `sh -c` or `cmd /C` on windows, they're quoted and passed as is.
+	Shell bool `yaml:"shell,omitempty"`
+
+	// BeforeRun is the steps run before each start of the binary, like database migrations.
+	BeforeRun []Step `yaml:"before_run,omitempty"`
+
+	// AfterStop is the steps run once the binary was stopped, for a rebuild or when gwatch exits.
+	AfterStop []Step `yaml:"after_stop,omitempty"`
+
+	// StopSignal is the signal sent to the binary's process to stop it, like SIGTERM, SIGINT or SIGHUP.
+	StopSignal string `yaml:"stop_signal"`
+
+	// StopTimeout is how long the process is given to exit after the StopSignal, before it's killed.
+	StopTimeout time.Duration `yaml:"stop_timeout"`
+
+	// Restart is when the binary is started again once it exited on it's own: never (the default), on-failure or always.
+	Restart string `yaml:"restart,omitempty"`
+}
+
+// Command returns the binary & it's arguments as a command.
+func (r RunConfig) Command() Command {
+	return Command{Args: append([]string{r.Bin}, r.Args...)}
+}
+
+// Build represents the build configuration for the runner.
+type BuildConfig struct {
+	// BeforeBuild is the steps run before the build, like code generators.
+	BeforeBuild []Step `yaml:"before_build,omitempty"`
+
+	// Cmd is the build command to be executed.
+	Cmd Command `yaml:"cmd"`
+
+	// Shell runs the build command through the shell, `sh -c` or `cmd /C` on windows.
+	// it's needed for pipes, redirections or lists of commands.
+	Shell bool `yaml:"shell,omitempty"`
+
+	// Steps is the build steps run in order instead of Cmd, if any.
+	Steps []Step `yaml:"steps,omitempty"`
+
+	// AfterBuild is the steps run once the build steps succeeded.
+	AfterBuild []Step `yaml:"after_build,omitempty"`
+}
+
+// BuildSteps returns the build steps, the build command is the single build step unless the Steps are listed.
+func (b BuildConfig) BuildSteps() []Step {
+	if len(b.Steps) > 0 {
+		return b.Steps
+	}
+
+	return []Step{{Cmd: b.Cmd, Shell: b.Shell}}
+}
+
+// ProcessConfig represents one of the processes built & run together, in place of the run binary.
+type ProcessConfig struct {
+	// Name is the name of the process, it's the default log prefix.
+	Name string `yaml:"name"`
+
+	// Target is the package pattern the process is built from, relative to the root directory, like ./cmd/api.
+	Target string `yaml:"target"`
+
+	// Build is the build command of the process, `go build -o <bin> <target>` by default.
+	Build Command `yaml:"build,omitempty"`
+
+	// Bin is the binary the target is built to, by default it's named after the process, next to the run binary.
+	Bin string `yaml:"bin,omitempty"`
+
+	// Args are the arguments to be passed to the binary.
+	Args []string `yaml:"args,flow,omitempty"`
+
+	// LogPrefix is the prefix added to the process output, it's the process name by default.
+	LogPrefix string `yaml:"log_prefix,omitempty"`
+
+	// Color is the color of the log prefix: red, cyan, blue, white, green, yellow or magenta.
+	Color string `yaml:"color,omitempty"`
+
+	// Restart is when the process is started again once it exited on it's own, the run restart policy by default.
+	Restart string `yaml:"restart,omitempty"`
+}
+
+// Step is a command of the build & run pipeline.
+type Step struct {
+	// Name is the name the step is logged with, it's command by default.
+	Name string `yaml:"name,omitempty"`
+
+	// Cmd is the command of the step.
+	Cmd Command `yaml:"cmd"`
+
+	// Shell runs the command through the shell, `sh -c` or `cmd /C` on windows.
+	Shell bool `yaml:"shell,omitempty"`
+
+	// OnFailure is what happens when the step fails: `abort` the pipeline (the default), `continue` or `warn` and continue.
+	OnFailure string `yaml:"on_failure,omitempty"`
+}
+
+// Command is a command written as a command line, split with the shell quoting rules, or as a list of arguments.
+type Command struct {
+	// Line is the command line, it's empty if the command is a list of arguments.
+	Line string
+
+	// Args is the list of arguments, it's nil if the command is a command line.
+	Args []string
+}
+
+// String returns the command line, or the arguments separated by spaces.
+func (c Command) String() string {
+	if c.Args != nil {
+		return strings.Join(c.Args, " ")
+	}
+
+	return c.Line
+}
+
+func (c *Command) UnmarshalYAML(node *yaml.Node) error {
+	*c = Command{}
+
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return node.Decode(&c.Line)
+
+	case yaml.SequenceNode:
+		return node.Decode(&c.Args)
+	}
+
+	return fmt.Errorf("line %d: the command must be a command line or a list of arguments", node.Line)
+}
+
+func (c Command) MarshalYAML() (any, error) {
+	if c.Args != nil {
+		return c.Args, nil
+	}
+
+	return c.Line, nil
+}
+
+// New reads the config file in the root directory and returns it.
+// If the config file does not exist, it creates a new config file with the defaults and returns it.
+//
+// The config file is expected to be in YAML format.
+//
+// It returns a pointer to a Config and an error. If successful, the error is nil.
+func New() (*Config, error) {
+	var (
+		config  = Default()
+		loadErr error
+	)
+
+	defer func() {
+		if val := recover(); val != nil {
+			if err, ok := val.(error); ok {
+				loadErr = fmt.Errorf("error loading config file: %w", err)
+			}
+		}
+	}()
+
+	// if config file don't exists create new one and write our defaults to it, then return it.
+	if _, err := os.Stat(ConfigPath); err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		if err := createAndWriteConfigFile(ConfigPath, *config); err != nil {
+			return nil, err
+		}
+
+		return config, nil
+	}
+
+	// read config file and merge it with our defaults, then return it.
+	byts, err := os.ReadFile(ConfigPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = yaml.Unmarshal(byts, config); err != nil {
+		return nil, err
+	}
+
+	if err = config.validate(); err != nil {
+		return nil, err
+	}
+
+	return config, loadErr
+}
+
+// Default returns a pointer to a new Config initialized with the default values.
+func Default() *Config {
+	return &Config{
+		Root:                rootDir,
+		Exts:                defaultExts,
+		Paths:               defaultPaths,
+		Include:             defaultInclude,
+		Exclude:             defaultExclude,
+		EditorIgnore:        defaultEditorIgnore,
+		IgnoreFiles:         defaultIgnoreFiles,
+		Source:              defaultSource,
+		Delay:               defaultDelay,
+		Recursive:           defaultRecursive,
+		Debounce:            defaultDebounce,
+		Backend:             defaultBackend,
+		PollInterval:        defaultPollInterval,
+		SkipUnchanged:       defaultSkipUnchanged,
+		PersistFingerprints: defaultPersistFingerprints,
+		WatchDeps:           defaultWatchDeps,
+		DepsTarget:          defaultDepsTarget,
+		WatchLocalModules:   defaultWatchLocalModules,
+		FollowSymlinks:      defaultFollowSymlinks,
+		HoldGitOperations:   defaultHoldGitOperations,
+		GitLockTimeout:      defaultGitLockTimeout,
+		LogPrefix:           defaultLogPrefix,
+
+		Run: RunConfig{
+			Bin:         defaultBinPath,
+			Args:        []string{},
+			StopSignal:  defaultStopSignal,
+			StopTimeout: defaultStopTimeout,
+		},
+
+		Build: BuildConfig{
+			Cmd: Command{Line: defaultBuildCmd},
+		},
+	}
+}
+
+// validate returns an error naming the config file & the option if an option is invalid.
+// the watch source is validated by the watcher, as the git source needs the repository.
+func (c *Config) validate() error {
+	if !c.Debounce.Leading && !c.Debounce.Trailing {
+		return fmt.Errorf("%s: debounce: leading or trailing must be enabled, the changes would never be run", ConfigPath)
+	}
+
+	if c.HoldGitOperations && c.GitLockTimeout <= 0 {
+		return fmt.Errorf("%s: git_lock_timeout: must be positive, got %s", ConfigPath, c.GitLockTimeout)
+	}
+
+	return nil
+}
+
+// createAndWriteConfigFile creates a new config file at the specified path and writes the provided config to it.
+//
+// Returns an error if the file creation or writing process fails.
+func createAndWriteConfigFile(path string, config Config) error {
+	file, err := os.Create(path)
+
+	if err != nil {
+		return fmt.Errorf("error creating config file: %w", err)
+	}
+
+	defer file.Close()
+
+	// write config to file
+	// yaml.
+	if err := yaml.NewEncoder(file).Encode(config); err != nil {
+
+		// delete the new config file incase of write error
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("error deleting config file after write failure: %w", err)
+		}
+
+		return fmt.Errorf("error writing new config file: %w", err)
+	}
+
+	return nil
+}
+
+// StateDir returns the path of the directory gwatch persists it's state to.
+func (c *Config) StateDir() string {
+	return filepath.Join(c.Root, stateDirName)
+}
+
+// Reload reloads the configuration from the config file, updating the current Config instance.
+//
+// It reads the config file from the root directory and updates the fields of the current Config instance.
+//
+// Returns an error if there was an issue reading or parsing the config file.
+func (c *Config) Reload() error {
+	config, err := New()
+	if err != nil {
+		return err
+	}
+
+	*c = *config
+	return nil
+}
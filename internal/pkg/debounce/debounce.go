@@ -0,0 +1,196 @@
+// Package debounce provides a concurrency-safe debouncer with leading edge, trailing edge & max wait support.
+package debounce
+
+import (
+	"sync"
+	"time"
+)
+
+// Timer is a timer created by a Clock.
+type Timer interface {
+	// Stop prevents the timer from firing, it reports whether the timer was stopped before it fired.
+	Stop() bool
+}
+
+// Clock abstracts the passing of time, so the debouncer can be tested without waiting.
+type Clock interface {
+	// AfterFunc calls f in it's own goroutine after the duration elapsed.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// realClock is the Clock backed by the time package.
+type realClock struct{}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// RealClock is the Clock backed by the time package.
+var RealClock Clock = realClock{}
+
+// Options configures a Debouncer.
+type Options struct {
+	// Wait is the quiet period after the last trigger that ends a burst of triggers.
+	Wait time.Duration
+
+	// Leading enables calling the function on the first trigger of a burst.
+	Leading bool
+
+	// Trailing enables calling the function at the end of a burst, if it was triggered since the last call.
+	Trailing bool
+
+	// MaxWait is the maximum time the function call can be delayed by a burst of triggers,
+	// so a continuous burst still calls the function at least every MaxWait. zero disables it.
+	MaxWait time.Duration
+
+	// Clock is the clock used to schedule the calls, it defaults to RealClock.
+	Clock Clock
+}
+
+// Debouncer delays and groups the calls of a function triggered in bursts.
+type Debouncer struct {
+	// f is the debounced function
+	f func()
+
+	// opts is the debouncer options
+	opts Options
+
+	// memAccess prevent concurrent access to the debouncer state
+	memAccess *sync.Mutex
+
+	// timer is the timer ending the current burst
+	timer Timer
+
+	// maxTimer is the timer enforcing MaxWait during the current burst
+	maxTimer Timer
+
+	// generation is incremented for each new timer, so stale timers that fired before they could be stopped are ignored
+	generation uint64
+
+	// burst is incremented when a burst ends, so stale max wait timers of previous bursts are ignored
+	burst uint64
+
+	// inBurst is true in between the first trigger of a burst and the end of it's quiet period
+	inBurst bool
+
+	// pending is true if the function was triggered since the last call
+	pending bool
+}
+
+// New creates a new debouncer calling f according to the options.
+func New(f func(), opts Options) *Debouncer {
+	if opts.Clock == nil {
+		opts.Clock = RealClock
+	}
+
+	return &Debouncer{
+		f:         f,
+		opts:      opts,
+		memAccess: new(sync.Mutex),
+	}
+}
+
+// Trigger triggers a call of the debounced function.
+//
+// on the leading edge, the function is called synchronously in the calling goroutine,
+// other calls happen in the clock's timer goroutines.
+func (d *Debouncer) Trigger() {
+	d.memAccess.Lock()
+
+	callNow := false
+
+	if !d.inBurst {
+		d.inBurst = true
+		callNow = d.opts.Leading
+
+		if d.opts.MaxWait > 0 {
+			d.scheduleMaxWait()
+		}
+	}
+
+	d.pending = !callNow
+
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+
+	d.generation++
+	generation := d.generation
+	d.timer = d.opts.Clock.AfterFunc(d.opts.Wait, func() { d.endBurst(generation) })
+
+	d.memAccess.Unlock()
+
+	if callNow {
+		d.f()
+	}
+}
+
+// Stop cancels the pending calls of the debounced function.
+func (d *Debouncer) Stop() {
+	d.memAccess.Lock()
+	defer d.memAccess.Unlock()
+
+	d.reset()
+}
+
+// endBurst is called once the quiet period after the last trigger elapsed.
+func (d *Debouncer) endBurst(generation uint64) {
+	d.memAccess.Lock()
+
+	if generation != d.generation {
+		d.memAccess.Unlock()
+		return
+	}
+
+	callNow := d.pending && d.opts.Trailing
+
+	d.reset()
+	d.memAccess.Unlock()
+
+	if callNow {
+		d.f()
+	}
+}
+
+// scheduleMaxWait schedules the next max wait call, the caller must hold memAccess.
+func (d *Debouncer) scheduleMaxWait() {
+	burst := d.burst
+
+	d.maxTimer = d.opts.Clock.AfterFunc(d.opts.MaxWait, func() {
+		d.memAccess.Lock()
+
+		// the burst ended or was stopped
+		if burst != d.burst {
+			d.memAccess.Unlock()
+			return
+		}
+
+		callNow := d.pending
+		d.pending = false
+
+		d.scheduleMaxWait()
+		d.memAccess.Unlock()
+
+		if callNow {
+			d.f()
+		}
+	})
+}
+
+// reset ends the current burst and stops it's timers, the caller must hold memAccess.
+func (d *Debouncer) reset() {
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+
+	if d.maxTimer != nil {
+		d.maxTimer.Stop()
+	}
+
+	d.burst++
+	d.generation++
+	d.timer = nil
+	d.maxTimer = nil
+	d.inBurst = false
+	d.pending = false
+}
@@ -0,0 +1,165 @@
+package debounce_test
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/huboh/gwatch/internal/pkg/debounce"
+)
+
+// fakeTimer is a timer of fakeClock.
+type fakeTimer struct {
+	at      time.Duration
+	f       func()
+	stopped bool
+}
+
+func (t *fakeTimer) Stop() bool {
+	stopped := !t.stopped
+	t.stopped = true
+
+	return stopped
+}
+
+// fakeClock is a clock that only moves forward when advanced, firing the due timers synchronously.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Duration
+	timers []*fakeTimer
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) debounce.Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &fakeTimer{at: c.now + d, f: f}
+	c.timers = append(c.timers, t)
+
+	return t
+}
+
+// Advance moves the clock forward by d, firing the timers due in order.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now + d
+	c.mu.Unlock()
+
+	for {
+		c.mu.Lock()
+
+		sort.SliceStable(c.timers, func(i, j int) bool { return c.timers[i].at < c.timers[j].at })
+
+		if len(c.timers) == 0 || c.timers[0].at > end {
+			c.now = end
+			c.mu.Unlock()
+			return
+		}
+
+		t := c.timers[0]
+		c.timers = c.timers[1:]
+		c.now = t.at
+		c.mu.Unlock()
+
+		if !t.stopped {
+			t.stopped = true
+			t.f()
+		}
+	}
+}
+
+func TestDebouncer(t *testing.T) {
+	type TestData struct {
+		name string
+		opts debounce.Options
+
+		// triggers is the time of each trigger, relative to the start
+		triggers []time.Duration
+
+		// calls is the expected time of each call, relative to the start
+		calls []time.Duration
+	}
+
+	ms := time.Millisecond
+
+	testData := []TestData{
+		{
+			name:     "trailing",
+			opts:     debounce.Options{Wait: 100 * ms, Trailing: true},
+			triggers: []time.Duration{0, 50 * ms, 100 * ms},
+			calls:    []time.Duration{200 * ms},
+		},
+		{
+			name:     "trailing separate bursts",
+			opts:     debounce.Options{Wait: 100 * ms, Trailing: true},
+			triggers: []time.Duration{0, 300 * ms},
+			calls:    []time.Duration{100 * ms, 400 * ms},
+		},
+		{
+			name:     "leading single trigger",
+			opts:     debounce.Options{Wait: 100 * ms, Leading: true, Trailing: true},
+			triggers: []time.Duration{0},
+			calls:    []time.Duration{0},
+		},
+		{
+			name:     "leading and trailing",
+			opts:     debounce.Options{Wait: 100 * ms, Leading: true, Trailing: true},
+			triggers: []time.Duration{0, 50 * ms},
+			calls:    []time.Duration{0, 150 * ms},
+		},
+		{
+			name:     "leading only",
+			opts:     debounce.Options{Wait: 100 * ms, Leading: true},
+			triggers: []time.Duration{0, 50 * ms, 250 * ms},
+			calls:    []time.Duration{0, 250 * ms},
+		},
+		{
+			name:     "max wait",
+			opts:     debounce.Options{Wait: 100 * ms, Trailing: true, MaxWait: 250 * ms},
+			triggers: []time.Duration{0, 80 * ms, 160 * ms, 240 * ms, 320 * ms, 400 * ms},
+			calls:    []time.Duration{250 * ms, 500 * ms},
+		},
+	}
+
+	for _, td := range testData {
+		t.Run(fmt.Sprintf("Debouncer \"%s\"", td.name), func(t *testing.T) {
+			var (
+				calls []time.Duration
+				clock = &fakeClock{}
+			)
+
+			td.opts.Clock = clock
+
+			d := debounce.New(func() { calls = append(calls, clock.now) }, td.opts)
+
+			for _, at := range td.triggers {
+				clock.Advance(at - clock.now)
+				d.Trigger()
+			}
+
+			clock.Advance(time.Second)
+
+			if fmt.Sprint(calls) != fmt.Sprint(td.calls) {
+				t.Errorf("expected calls at %v got %v\n", td.calls, calls)
+			}
+		})
+	}
+}
+
+func TestDebouncerStop(t *testing.T) {
+	var (
+		calls = 0
+		clock = &fakeClock{}
+		d     = debounce.New(func() { calls++ }, debounce.Options{Wait: time.Millisecond, Trailing: true, Clock: clock})
+	)
+
+	d.Trigger()
+	d.Stop()
+	clock.Advance(time.Second)
+
+	if calls != 0 {
+		t.Errorf("expected no calls after stop got %d\n", calls)
+	}
+}
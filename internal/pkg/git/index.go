@@ -0,0 +1,132 @@
+package git
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	// indexSignature is the signature at the start of the index file
+	indexSignature = "DIRC"
+
+	// indexEntrySize is the size of the fixed part of an index entry, from it's ctime to it's flags, with a sha-1 object name
+	indexEntrySize = 62
+
+	// flagExtended marks the entries followed by the extended flags, in version 3 and later
+	flagExtended = 0x4000
+)
+
+// errIndexCorrupted is returned when the index file ends before it's entries.
+var errIndexCorrupted = errors.New("index file corrupted")
+
+// ReadIndex returns the slash separated paths, relative to the work tree, of the entries of the index file at path,
+// which is the list of the files tracked by git. versions 2, 3 & 4 of the index format are supported.
+func ReadIndex(path string) ([]string, error) {
+	byts, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := parseIndex(byts)
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading git index %s: %w", path, err)
+	}
+
+	return paths, nil
+}
+
+// parseIndex parses the entries of the index file content.
+func parseIndex(byts []byte) ([]string, error) {
+	if len(byts) < 12 || string(byts[:4]) != indexSignature {
+		return nil, errors.New("not a git index file")
+	}
+
+	var (
+		version = binary.BigEndian.Uint32(byts[4:8])
+		count   = binary.BigEndian.Uint32(byts[8:12])
+		paths   = make([]string, 0, count)
+		offset  = 12
+		prev    []byte
+	)
+
+	if version < 2 || version > 4 {
+		return nil, fmt.Errorf("unsupported index version %d", version)
+	}
+
+	for i := uint32(0); i < count; i++ {
+		start := offset
+
+		if offset+indexEntrySize > len(byts) {
+			return nil, errIndexCorrupted
+		}
+
+		flags := binary.BigEndian.Uint16(byts[offset+indexEntrySize-2:])
+		offset += indexEntrySize
+
+		if version >= 3 && flags&flagExtended != 0 {
+			offset += 2
+		}
+
+		var name []byte
+
+		// version 4 paths are prefix compressed: the number of bytes to remove from the previous path, then the suffix
+		if version == 4 {
+			strip, n := readOffset(byts[min(offset, len(byts)):])
+
+			if n == 0 || strip > len(prev) {
+				return nil, errIndexCorrupted
+			}
+
+			offset += n
+			name = append(name, prev[:len(prev)-strip]...)
+		}
+
+		end := bytes.IndexByte(byts[min(offset, len(byts)):], 0)
+
+		if end < 0 {
+			return nil, errIndexCorrupted
+		}
+
+		name = append(name, byts[offset:offset+end]...)
+		offset += end + 1
+
+		// version 2 & 3 entries are padded with 1 to 8 nul bytes to a multiple of 8 bytes
+		if version < 4 {
+			offset = start + (offset-1-start+8)/8*8
+		}
+
+		// unmerged files have an entry per stage
+		if len(paths) == 0 || paths[len(paths)-1] != string(name) {
+			paths = append(paths, string(name))
+		}
+
+		prev = name
+	}
+
+	return paths, nil
+}
+
+// readOffset reads the variable length integer of the version 4 entries, it returns the number of bytes read,
+// or 0 if the integer is truncated.
+func readOffset(byts []byte) (int, int) {
+	value := 0
+
+	for i, b := range byts {
+		if i > 0 {
+			value++
+		}
+
+		value = value<<7 | int(b&0x7f)
+
+		if b&0x80 == 0 {
+			return value, i + 1
+		}
+	}
+
+	return 0, 0
+}
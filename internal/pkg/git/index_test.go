@@ -0,0 +1,69 @@
+package git_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/huboh/gwatch/internal/pkg/git"
+)
+
+func TestReadIndex(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	var (
+		root  = t.TempDir()
+		files = []string{"a/very/long/directory/name/file.go", "a/very/long/directory/name/other.go", "go.mod", "intent.go", "main.go", "z.go"}
+	)
+
+	run := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = root
+
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s %s\n", args, err, out)
+		}
+	}
+
+	for _, file := range append(slices.Clone(files), "untracked.go") {
+		path := filepath.Join(root, filepath.FromSlash(file))
+
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte("package main"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run("init", "-q")
+	run("add", "go.mod", "main.go", "z.go", "a")
+
+	// intent-to-add entries have extended flags
+	run("add", "--intent-to-add", "intent.go")
+
+	workTree, gitDir := git.FindRepo(filepath.Join(root, "a", "very"))
+
+	if workTree != root || gitDir != filepath.Join(root, ".git") {
+		t.Fatalf("expected repository %s got %s, %s\n", root, workTree, gitDir)
+	}
+
+	for _, version := range []string{"2", "3", "4"} {
+		run("update-index", "--index-version", version)
+
+		paths, err := git.ReadIndex(filepath.Join(gitDir, "index"))
+
+		if err != nil {
+			t.Fatalf("version %s: %s\n", version, err)
+		}
+
+		if !slices.Equal(paths, files) {
+			t.Errorf("version %s: expected %v got %v\n", version, files, paths)
+		}
+	}
+}
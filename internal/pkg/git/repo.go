@@ -0,0 +1,47 @@
+// Package git reads the state of git repositories from their git directory, without running git.
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FindRepo returns the work tree & git directory of the repository containing dir, or empty strings if it's not in one.
+// the `.git` file of worktrees & submodules is followed to their git directory.
+func FindRepo(dir string) (workTree string, gitDir string) {
+	for dir = filepath.Clean(dir); ; dir = filepath.Dir(dir) {
+		path := filepath.Join(dir, ".git")
+		stat, err := os.Stat(path)
+
+		switch {
+		case err != nil:
+
+		case stat.IsDir():
+			return dir, path
+
+		case stat.Mode().IsRegular():
+			byts, err := os.ReadFile(path)
+
+			if err != nil {
+				return "", ""
+			}
+
+			gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(byts)), "gitdir:")
+
+			if !ok {
+				return "", ""
+			}
+
+			if gitDir = filepath.FromSlash(strings.TrimSpace(gitDir)); !filepath.IsAbs(gitDir) {
+				gitDir = filepath.Join(dir, gitDir)
+			}
+
+			return dir, filepath.Clean(gitDir)
+		}
+
+		if dir == filepath.Dir(dir) {
+			return "", ""
+		}
+	}
+}
@@ -0,0 +1,172 @@
+// Package glob provides gitignore-style path matching built on doublestar (`**`) patterns.
+package glob
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// Rule represents a single compiled pattern.
+//
+// Patterns follow the gitignore conventions:
+//   - a pattern without a slash matches a name at any depth below the rule's base directory.
+//   - a pattern containing a slash is anchored to the rule's base directory.
+//   - a leading `!` negates the pattern, re-including paths matched by earlier rules.
+//   - a trailing `/` makes the pattern only match directories.
+//   - `**` matches zero or more directories.
+type Rule struct {
+	// Pattern is the pattern as written by the user.
+	Pattern string
+
+	// Source describes where the rule came from, e.g "exclude" or ".gitignore".
+	Source string
+
+	// Negate is true if the rule re-includes paths matched by earlier rules.
+	Negate bool
+
+	// DirOnly is true if the rule only matches directories.
+	DirOnly bool
+
+	// glob is the doublestar pattern anchored to the rule's base directory.
+	glob string
+}
+
+// Rules is an ordered list of rules, the last matching rule wins.
+type Rules []*Rule
+
+// NewRule compiles pattern into a rule relative to the base directory.
+//
+// base and the paths later passed to Match are slash separated and relative to the same root,
+// an empty base or "." means the root itself.
+//
+// It returns a nil rule for blank patterns and comments.
+func NewRule(base, source, pattern string) (*Rule, error) {
+	var (
+		p = strings.TrimSpace(pattern)
+		r = &Rule{Pattern: p, Source: source}
+	)
+
+	if p == "" || strings.HasPrefix(p, "#") {
+		return nil, nil
+	}
+
+	switch {
+	case strings.HasPrefix(p, "!"):
+		r.Negate = true
+		p = p[1:]
+
+	case strings.HasPrefix(p, `\!`), strings.HasPrefix(p, `\#`):
+		p = p[1:]
+	}
+
+	if strings.HasSuffix(p, "/") {
+		r.DirOnly = true
+		p = strings.TrimRight(p, "/")
+	}
+
+	if p == "" {
+		return nil, fmt.Errorf("invalid pattern %q", pattern)
+	}
+
+	// patterns with a slash are anchored to the base, others match at any depth
+	if strings.Contains(p, "/") {
+		p = strings.TrimPrefix(p, "/")
+	} else {
+		p = "**/" + p
+	}
+
+	r.glob = path.Join(escape(base), p)
+
+	if !doublestar.ValidatePattern(r.glob) {
+		return nil, fmt.Errorf("invalid pattern %q", pattern)
+	}
+
+	return r, nil
+}
+
+// Compile compiles the patterns into rules relative to the base directory.
+func Compile(base, source string, patterns []string) (Rules, error) {
+	rules := make(Rules, 0, len(patterns))
+
+	for _, p := range patterns {
+		r, err := NewRule(base, source, p)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if r != nil {
+			rules = append(rules, r)
+		}
+	}
+
+	return rules, nil
+}
+
+// Match reports whether the slash separated path matches the rule.
+func (r *Rule) Match(name string, isDir bool) bool {
+	if r.DirOnly && !isDir {
+		return false
+	}
+
+	// the pattern is validated at compile time, so no error can be returned here
+	ok, _ := doublestar.Match(r.glob, name)
+
+	return ok
+}
+
+// String returns the pattern along with it's source.
+func (r *Rule) String() string {
+	return fmt.Sprintf("%s (%s)", r.Pattern, r.Source)
+}
+
+// Match returns the last rule matching the path itself, or nil if no rule matches.
+func (rs Rules) Match(name string, isDir bool) *Rule {
+	for i := len(rs) - 1; i >= 0; i-- {
+		if rs[i].Match(name, isDir) {
+			return rs[i]
+		}
+	}
+
+	return nil
+}
+
+// Excludes reports whether the path or any of it's parent directories is matched by a non-negated rule.
+// Like git, a path can not be re-included if one of it's parent directories is excluded.
+//
+// It also returns the rule that made the decision, which is nil if no rule matched.
+func (rs Rules) Excludes(name string, isDir bool) (bool, *Rule) {
+	name = path.Clean(name)
+
+	for i := 0; i < len(name); i++ {
+		if name[i] != '/' {
+			continue
+		}
+
+		if r := rs.Match(name[:i], true); r != nil && !r.Negate {
+			return true, r
+		}
+	}
+
+	r := rs.Match(name, isDir)
+
+	return r != nil && !r.Negate, r
+}
+
+// escape escapes the glob meta characters in a literal path.
+func escape(s string) string {
+	var b strings.Builder
+
+	for _, c := range s {
+		if strings.ContainsRune(`*?[]{}\`, c) {
+			b.WriteRune('\\')
+		}
+
+		b.WriteRune(c)
+	}
+
+	return b.String()
+}
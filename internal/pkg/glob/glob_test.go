@@ -0,0 +1,96 @@
+package glob_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/huboh/gwatch/internal/pkg/glob"
+)
+
+func TestExcludes(t *testing.T) {
+	type TestData struct {
+		path     string
+		isDir    bool
+		base     string
+		patterns []string
+		excluded bool
+	}
+
+	testData := []TestData{
+		{
+			path:     "web/app/node_modules",
+			isDir:    true,
+			patterns: []string{"node_modules"},
+			excluded: true,
+		},
+		{
+			path:     "internal/pkg/models_gen.go",
+			patterns: []string{"**/*_gen.go"},
+			excluded: true,
+		},
+		{
+			path:     "internal/pkg/testdata/file.go",
+			patterns: []string{"internal/**/testdata"},
+			excluded: true,
+		},
+		{
+			path:     "cmd/testdata/file.go",
+			patterns: []string{"internal/**/testdata"},
+			excluded: false,
+		},
+		{
+			path:     "internal/keep_gen.go",
+			patterns: []string{"**/*_gen.go", "!internal/keep_gen.go"},
+			excluded: false,
+		},
+		{
+			path:     "web/dist/keep.js",
+			patterns: []string{"web/dist", "!web/dist/keep.js"},
+			excluded: true,
+		},
+		{
+			path:     "build",
+			patterns: []string{"build/"},
+			excluded: false,
+		},
+		{
+			path:     "build/main.go",
+			patterns: []string{"build/"},
+			excluded: true,
+		},
+		{
+			path:     "sub/tmp/a.go",
+			base:     "sub",
+			patterns: []string{"/tmp"},
+			excluded: true,
+		},
+		{
+			path:     "tmp/a.go",
+			base:     "sub",
+			patterns: []string{"/tmp"},
+			excluded: false,
+		},
+	}
+
+	for _, td := range testData {
+		t.Run(fmt.Sprintf("Excludes \"%s\" %v", td.path, td.patterns), func(t *testing.T) {
+			rules, err := glob.Compile(td.base, "test", td.patterns)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if excluded, _ := rules.Excludes(td.path, td.isDir); excluded != td.excluded {
+				t.Errorf("expected %v got %v\n", td.excluded, excluded)
+			}
+		})
+	}
+}
+
+func TestCompileInvalid(t *testing.T) {
+	for _, p := range []string{"!", "[a-"} {
+		if _, err := glob.Compile("", "test", []string{p}); err == nil {
+			t.Errorf("expected error for pattern %q", p)
+		}
+	}
+}
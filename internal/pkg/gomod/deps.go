@@ -0,0 +1,104 @@
+// Package gomod provides functionality for inspecting go modules, their packages & dependencies.
+package gomod
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+)
+
+// Module is a module as reported by `go list -json`.
+type Module struct {
+	// Path is the module path
+	Path string
+
+	// Version is the module version, it's empty for the main & local replacement modules
+	Version string
+
+	// Main is true for the main module, and the go.work members
+	Main bool
+
+	// Dir is the directory holding the module files
+	Dir string
+
+	// Replace is the module replacing this module, if any
+	Replace *Module
+}
+
+// Package is a package as reported by `go list -json`.
+type Package struct {
+	// Dir is the directory containing the package sources
+	Dir string
+
+	// ImportPath is the package import path
+	ImportPath string
+
+	// Standard is true if the package is part of the standard library
+	Standard bool
+
+	// Module is the module containing the package, it's nil for the standard library packages
+	Module *Module
+
+	// EmbedFiles is the files embedded by the package's go:embed directives, relative to Dir
+	EmbedFiles []string
+}
+
+// IsLocal reports whether the package sources are editable, i.e the package belongs to the main module,
+// a go.work member, or a module replaced by a local directory. other modules live in the read-only module cache.
+func (p Package) IsLocal() bool {
+	switch {
+	case p.Standard || p.Module == nil:
+		return false
+
+	case p.Module.Main:
+		return true
+
+	case p.Module.Replace != nil:
+		// local directory replacements have no version
+		return p.Module.Replace.Version == ""
+	}
+
+	return false
+}
+
+// Deps returns the packages in the dependency closure of the target package patterns, including the targets.
+//
+// It runs `go list -e -deps` in dir, so packages with errors (like a file being edited) are still reported.
+func Deps(dir string, targets ...string) ([]Package, error) {
+	var (
+		stdout bytes.Buffer
+		stderr bytes.Buffer
+		args   = append([]string{"list", "-e", "-deps", "-json=Dir,ImportPath,Standard,Module,EmbedFiles"}, targets...)
+		cmd    = exec.Command("go", args...)
+	)
+
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error listing dependencies of %v: %w: %s", targets, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	var (
+		pkgs    []Package
+		decoder = json.NewDecoder(&stdout)
+	)
+
+	for {
+		var pkg Package
+
+		if err := decoder.Decode(&pkg); err != nil {
+			if errors.Is(err, io.EOF) {
+				return pkgs, nil
+			}
+
+			return nil, fmt.Errorf("error decoding dependencies of %v: %w", targets, err)
+		}
+
+		pkgs = append(pkgs, pkg)
+	}
+}
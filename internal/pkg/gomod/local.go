@@ -0,0 +1,117 @@
+package gomod
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+
+	"golang.org/x/mod/modfile"
+)
+
+// LocalModules returns the directories of the local modules the module in dir is developed with:
+// the directories of go.mod's local replace directives, and the go.work members & local replace directives.
+//
+// The go.work file is looked up like the go command does, from the GOWORK environment variable
+// or in dir and it's parent directories. The module in dir is not part of the result.
+func LocalModules(dir string) ([]string, error) {
+	var dirs []string
+
+	abs, err := filepath.Abs(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{filepath.Join(abs, "go.mod")}
+
+	if work := WorkFile(abs); work != "" {
+		files = append(files, work)
+	}
+
+	for _, file := range files {
+		byts, err := os.ReadFile(file)
+
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		var (
+			base     = filepath.Dir(file)
+			replaces []*modfile.Replace
+		)
+
+		if filepath.Base(file) == "go.mod" {
+			mod, err := modfile.Parse(file, byts, nil)
+
+			if err != nil {
+				return nil, err
+			}
+
+			replaces = mod.Replace
+		} else {
+			work, err := modfile.ParseWork(file, byts, nil)
+
+			if err != nil {
+				return nil, err
+			}
+
+			for _, use := range work.Use {
+				dirs = append(dirs, resolve(base, use.Path))
+			}
+
+			replaces = work.Replace
+		}
+
+		for _, r := range replaces {
+			// local directory replacements have no version
+			if r.New.Version == "" {
+				dirs = append(dirs, resolve(base, r.New.Path))
+			}
+		}
+	}
+
+	slices.Sort(dirs)
+
+	return slices.DeleteFunc(slices.Compact(dirs), func(d string) bool { return d == abs }), nil
+}
+
+// WorkFile returns the path of the go.work file used for the module in dir, or an empty string if there is none.
+func WorkFile(dir string) string {
+	switch env := os.Getenv("GOWORK"); env {
+	case "off":
+		return ""
+
+	case "":
+		for dir = filepath.Clean(dir); ; dir = filepath.Dir(dir) {
+			if path := filepath.Join(dir, "go.work"); isFile(path) {
+				return path
+			}
+
+			if dir == filepath.Dir(dir) {
+				return ""
+			}
+		}
+
+	default:
+		return env
+	}
+}
+
+// resolve resolves the path relative to the base directory.
+func resolve(base, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+
+	return filepath.Join(base, filepath.FromSlash(path))
+}
+
+// isFile reports whether path is an existing regular file.
+func isFile(path string) bool {
+	stat, err := os.Stat(path)
+	return err == nil && stat.Mode().IsRegular()
+}
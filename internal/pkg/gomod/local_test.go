@@ -0,0 +1,135 @@
+package gomod_test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/huboh/gwatch/internal/pkg/gomod"
+)
+
+func TestLocalModules(t *testing.T) {
+	t.Setenv("GOWORK", "")
+
+	testData := []struct {
+		name    string
+		files   map[string]string
+		modules []string
+		err     bool
+	}{
+		{
+			name: "local replace directives",
+			files: map[string]string{
+				"app/go.mod": "module example.com/app\n\ngo 1.22\n\nreplace (\n\texample.com/a => ../a\n\texample.com/b v1.0.0 => ./third_party/b\n\texample.com/c => example.com/fork/c v1.2.0\n)\n",
+			},
+			modules: []string{"a", "app/third_party/b"},
+		},
+		{
+			name: "go.work members & replace directives",
+			files: map[string]string{
+				"app/go.mod": "module example.com/app\n\ngo 1.22\n",
+				"go.work":    "go 1.22\n\nuse (\n\t./app\n\t./lib\n)\n\nreplace example.com/d => ./d\n",
+			},
+			modules: []string{"d", "lib"},
+		},
+		{
+			name: "go.mod & go.work together",
+			files: map[string]string{
+				"app/go.mod": "module example.com/app\n\ngo 1.22\n\nreplace example.com/a => ../a\n",
+				"go.work":    "go 1.22\n\nuse ./app\nuse ./a\n",
+			},
+			modules: []string{"a"},
+		},
+		{
+			name:    "no go.mod file",
+			files:   map[string]string{"app/main.go": "package main\n"},
+			modules: nil,
+		},
+		{
+			name:  "malformed go.mod file",
+			files: map[string]string{"app/go.mod": "module example.com/app\n\nrequire (\n"},
+			err:   true,
+		},
+		{
+			name: "malformed go.work file",
+			files: map[string]string{
+				"app/go.mod": "module example.com/app\n\ngo 1.22\n",
+				"go.work":    "go 1.22\n\nuse (\n",
+			},
+			err: true,
+		},
+	}
+
+	for _, td := range testData {
+		t.Run(td.name, func(t *testing.T) {
+			root := t.TempDir()
+
+			for name, content := range td.files {
+				path := filepath.Join(root, filepath.FromSlash(name))
+
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			modules, err := gomod.LocalModules(filepath.Join(root, "app"))
+
+			if td.err {
+				if err == nil {
+					t.Errorf("expected an error got modules %v\n", modules)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var expected []string
+
+			for _, m := range td.modules {
+				expected = append(expected, filepath.Join(root, filepath.FromSlash(m)))
+			}
+
+			if !slices.Equal(modules, expected) {
+				t.Errorf("expected modules %v got %v\n", expected, modules)
+			}
+		})
+	}
+}
+
+func TestWorkFile(t *testing.T) {
+	root := t.TempDir()
+	app := filepath.Join(root, "app")
+
+	if err := os.MkdirAll(app, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "go.work"), []byte("go 1.22\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	testData := []struct {
+		env  string
+		file string
+	}{
+		{env: "", file: filepath.Join(root, "go.work")},
+		{env: "off", file: ""},
+		{env: "/elsewhere/go.work", file: "/elsewhere/go.work"},
+	}
+
+	for _, td := range testData {
+		t.Setenv("GOWORK", td.env)
+
+		if file := gomod.WorkFile(app); file != td.file {
+			t.Errorf("GOWORK=%q: expected %q got %q\n", td.env, td.file, file)
+		}
+	}
+}
@@ -98,6 +98,14 @@ func (l *logger) Watcher() LogFunc {
 	return l.getLogger(Blue)
 }
 
+func (l *logger) Error() LogFunc {
+	return l.getLogger(Red)
+}
+
+func (l *logger) Warning() LogFunc {
+	return l.getLogger(Magenta)
+}
+
 func (l *logger) getLogger(name Color) LogFunc {
 	v, ok := l.Loggers[name]
 
@@ -131,5 +139,5 @@ func ClearConsole() error {
 		args = []string{"cmd", "/c", "cls"}
 	}
 
-	return runner.NewCommand(args, "").Run(os.Stdout, os.Stderr, nil)
+	return runner.NewCommand(runner.CommandLine{Args: args}, "", runner.StopOptions{Signal: os.Kill}).Run(os.Stdout, os.Stderr, nil)
 }
@@ -1,166 +1,417 @@
-package runner
-
-import (
-	"bufio"
-	"errors"
-	"fmt"
-	"io"
-	"os"
-	"os/exec"
-	"strings"
-	"sync"
-
-	"github.com/huboh/gwatch/internal/pkg/utils"
-)
-
-// Command represents a command to be executed.
-type Command struct {
-	// cmd is the underlying exec.Cmd instance.
-	cmd *exec.Cmd
-
-	// cmdMemAccess Mutex prevent concurrent access to the underlying command.
-	cmdMemAccess *sync.RWMutex
-
-	// args is the command arguments.
-	args []string
-
-	// done is a channel to signal completion or termination of the command.
-	done chan struct{}
-
-	// outPrefix is the prefix to add to the commands output.
-	outPrefix string
-}
-
-// NewCommand creates a new Command instance pointer with the provided arguments.
-//
-// Use Run method to execute the command.
-// Use Kill method to terminate the running command.
-func NewCommand(args []string, outPrefix string) *Command {
-	return &Command{
-		args:         args,
-		outPrefix:    outPrefix,
-		cmdMemAccess: new(sync.RWMutex),
-	}
-}
-
-// Run starts the command and waits for it to finish.
-func (c *Command) Run(stdout io.Writer, stderr io.Writer, onRun func()) error {
-	// checks if there is an active cmd instance in a diff goroutine
-	if c.IsActive() {
-		utils.CloseSafely(c.done)
-	}
-
-	// prevent other goroutine from resetting cmd while we're still running
-	c.cmdMemAccess.Lock()
-
-	// new cmd
-	c.cmd = exec.Command(c.args[0], c.args[1:]...)
-	c.done = make(chan struct{})
-
-	// pipe output from cmd process
-	c.PipeStdErr(stderr)
-	c.PipeStdOut(stdout)
-
-	// only release mem access when we exit.
-	defer func() {
-		// reset
-		c.cmd = nil
-		c.done = nil
-		c.cmdMemAccess.Unlock()
-	}()
-
-	if onRun != nil {
-		onRun()
-	}
-
-	// start cmd
-	if err := c.cmd.Start(); err != nil {
-		return err
-	}
-
-	select {
-	// kill cmd process
-	case <-c.done:
-		return c.Kill()
-
-	// Wait for the cmd to finish or be interrupted.
-	case err := <-utils.AsyncResult(c.cmd.Wait):
-		if err != nil {
-			// cmd was interrupted, so any exit error ignored
-			if err, isExitErr := err.(*exec.ExitError); !isExitErr {
-				return err
-			}
-		}
-	}
-
-	return nil
-}
-
-// Kill terminates the command and it's underlying process if it is still running.
-func (c *Command) Kill() error {
-	if c.IsActive() {
-		if err := c.cmd.Process.Signal(os.Kill); err != nil {
-			if !errors.Is(err, os.ErrProcessDone) {
-				return err
-			}
-		}
-	}
-
-	return nil
-}
-
-// IsActive checks if the command is still running
-func (c *Command) IsActive() bool {
-	// this field is alway set when the process starts and nil when it exits
-	return c.cmd != nil && c.cmd.Process != nil
-}
-
-func (c *Command) PipeStdOut(stdout io.Writer) error {
-	stdOutPipe, err := c.cmd.StdoutPipe()
-
-	if err != nil {
-		return err
-	}
-
-	// continuously monitor launched stdout and prints to stdout
-	go func() {
-		defer stdOutPipe.Close()
-
-		stdOutScanner := bufio.NewScanner(stdOutPipe)
-
-		if c.outPrefix != "" && !strings.HasSuffix(c.outPrefix, ":") {
-			c.outPrefix = c.outPrefix + ":"
-		}
-
-		for stdOutScanner.Scan() {
-			fmt.Fprintln(stdout, c.outPrefix, stdOutScanner.Text())
-		}
-	}()
-
-	return nil
-}
-
-func (c *Command) PipeStdErr(stderr io.Writer) error {
-	stdErrPipe, err := c.cmd.StderrPipe()
-
-	if err != nil {
-		return err
-	}
-
-	// continuously monitor launched command stderr and print to stderr
-	go func() {
-		defer stdErrPipe.Close()
-
-		stdErrScanner := bufio.NewScanner(stdErrPipe)
-
-		if c.outPrefix != "" && !strings.HasSuffix(c.outPrefix, ":") {
-			c.outPrefix = c.outPrefix + ":"
-		}
-
-		for stdErrScanner.Scan() {
-			fmt.Fprintln(stderr, c.outPrefix, stdErrScanner.Text())
-		}
-	}()
-
-	return nil
-}
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/huboh/gwatch/internal/pkg/utils"
+)
+
+// Command represents a command to be executed.
+type Command struct {
+	// cmd is the underlying exec.Cmd instance.
+	cmd *exec.Cmd
+
+	// cmdMemAccess Mutex prevent concurrent access to the underlying command.
+	cmdMemAccess *sync.RWMutex
+
+	// args is the command arguments.
+	args []string
+
+	// env is the environment variables set in addition to gwatch's, as `NAME=value`.
+	env []string
+
+	// done is a channel to signal completion or termination of the command.
+	// it's created before Run waits for the previous run, so the runs not started yet are stopped too.
+	done chan struct{}
+
+	// runMemAccess Mutex prevent concurrent access to the done channel, the running process id & the killed state.
+	runMemAccess *sync.Mutex
+
+	// pid is the id of the running process, it's zero if none is running.
+	pid int
+
+	// killed reports whether Kill was called while the process was running.
+	killed bool
+
+	// stops is the number of times the command was stopped, it's the stop generation of the runs registered since.
+	// see runUnlessStopped.
+	stops int
+
+	// runs is the number of unfinished runs by the stop generation they were registered in.
+	runs map[int]int
+
+	// runsDone is signaled when a run finished, so Stop waits for the runs it stopped. it's locker is runMemAccess.
+	runsDone *sync.Cond
+
+	// outPrefix is the prefix to add to the commands output.
+	outPrefix string
+
+	// outColor is the color of the output prefix, the prefix is not colored if it's nil.
+	outColor *color.Color
+
+	// stopOpts is how the process is stopped.
+	stopOpts StopOptions
+
+	// onStop is called with how the process exited once it was stopped.
+	onStop func(StopReport)
+
+	// pgid is the process group of the last started process, it's zero if none was started.
+	pgid int
+
+	// outputs is the writers of the running command's output.
+	outputs []*prefixWriter
+}
+
+// NewCommand creates a new Command instance pointer with the provided command line.
+//
+// Use Run method to execute the command.
+// Use Stop method to stop the running command, see StopOptions.
+// Use Kill method to terminate the running command.
+func NewCommand(cmdLine CommandLine, outPrefix string, stopOpts StopOptions) *Command {
+	runMemAccess := new(sync.Mutex)
+
+	return &Command{
+		args:         cmdLine.Args,
+		env:          cmdLine.Env,
+		outPrefix:    outPrefix,
+		stopOpts:     stopOpts,
+		cmdMemAccess: new(sync.RWMutex),
+		runMemAccess: runMemAccess,
+		runs:         make(map[int]int),
+		runsDone:     sync.NewCond(runMemAccess),
+	}
+}
+
+var (
+	// ErrStopped is returned by Run when the command was stopped by Stop, or by running it again.
+	ErrStopped = errors.New("command stopped")
+
+	// outputWaitDelay is how long the output still held by the descendants of an exited process is read for.
+	outputWaitDelay = time.Second
+)
+
+// Run starts the command and waits for it to finish.
+// It returns an *exec.ExitError if the command failed, and ErrStopped if it was stopped.
+func (c *Command) Run(stdout io.Writer, stderr io.Writer, onRun func()) error {
+	return c.run(stdout, stderr, onRun, -1)
+}
+
+// runUnlessStopped runs the command like Run, unless it was stopped again since stopGeneration returned stops,
+// it then returns ErrStopped without running it.
+func (c *Command) runUnlessStopped(stops int, stdout io.Writer, stderr io.Writer) error {
+	return c.run(stdout, stderr, nil, stops)
+}
+
+// run runs the command, unless stops is not negative and the command was stopped again since stopGeneration returned it.
+func (c *Command) run(stdout io.Writer, stderr io.Writer, onRun func(), stops int) error {
+	// stops the previous run, whether it's process is running or it's still waiting to start it
+	done := make(chan struct{})
+
+	c.runMemAccess.Lock()
+
+	if stops < 0 {
+		stops = c.stops
+	}
+
+	if c.stops != stops {
+		c.runMemAccess.Unlock()
+		return ErrStopped
+	}
+
+	c.closeDone()
+	c.done = done
+	c.runs[stops]++
+	c.runMemAccess.Unlock()
+
+	// prevent other goroutine from resetting cmd while we're still running
+	c.cmdMemAccess.Lock()
+
+	// new cmd, in it's own process group so it's descendants are stopped along with it
+	c.cmd = exec.Command(c.args[0], c.args[1:]...)
+	setProcessGroup(c.cmd)
+
+	if len(c.env) > 0 {
+		c.cmd.Env = append(os.Environ(), c.env...)
+	}
+
+	// pipe output from cmd process, the descendants still holding it once the process exited are only waited for a moment
+	c.PipeStdErr(stderr)
+	c.PipeStdOut(stdout)
+	c.cmd.WaitDelay = outputWaitDelay
+
+	// only release mem access when we exit.
+	defer func() {
+		for _, w := range c.outputs {
+			w.Flush()
+		}
+
+		// reset
+		c.runMemAccess.Lock()
+		if c.done == done {
+			c.done = nil
+		}
+		c.pid = 0
+		if c.runs[stops]--; c.runs[stops] == 0 {
+			delete(c.runs, stops)
+		}
+		c.runsDone.Broadcast()
+		c.runMemAccess.Unlock()
+
+		c.cmd = nil
+		c.outputs = nil
+		c.cmdMemAccess.Unlock()
+	}()
+
+	// the descendants of the last process must not outlive it, like servers still holding their port
+	if err := c.killGroup(); err != nil {
+		return err
+	}
+
+	// stopped while waiting for the previous run, by Stop or by a newer run
+	c.runMemAccess.Lock()
+	stopped := c.stops != stops
+	c.runMemAccess.Unlock()
+
+	select {
+	case <-done:
+		stopped = true
+
+	default:
+	}
+
+	if stopped {
+		return ErrStopped
+	}
+
+	if onRun != nil {
+		onRun()
+	}
+
+	// start cmd
+	if err := c.cmd.Start(); err != nil {
+		return err
+	}
+
+	c.pgid = c.cmd.Process.Pid
+
+	c.runMemAccess.Lock()
+	c.pid = c.pgid
+	c.killed = false
+	c.runMemAccess.Unlock()
+
+	exited := utils.AsyncResult(func() error {
+		if err := c.cmd.Wait(); !errors.Is(err, exec.ErrWaitDelay) {
+			return err
+		}
+
+		return nil
+	})
+
+	select {
+	// stop cmd process
+	case <-done:
+		if err := c.stop(exited); err != nil {
+			return err
+		}
+
+		return ErrStopped
+
+	// Wait for the cmd to finish or be interrupted.
+	case err := <-exited:
+		return err
+	}
+}
+
+// stop sends the stop signal to the process group, and kills it if the process & it's descendants did not exit within
+// the stop timeout. it waits for them to exit, then reports how they did to the stop handler.
+func (c *Command) stop(exited <-chan error) error {
+	var (
+		start  = time.Now()
+		report = StopReport{Signal: c.stopOpts.Signal, Timeout: c.stopOpts.Timeout}
+	)
+
+	if report.Signal == nil {
+		report.Signal = os.Kill
+	}
+
+	if report.Signal != os.Kill {
+		// the processes might have exited already, they're then reported as stopped by the signal
+		if err := signalGroup(c.pgid, report.Signal); err == nil || errors.Is(err, os.ErrProcessDone) {
+			select {
+			case <-exited:
+				// the descendants are given the rest of the timeout
+				if waitGroup(c.pgid, report.Timeout-time.Since(start)) {
+					c.runMemAccess.Lock()
+					report.Interrupted = c.killed
+					c.runMemAccess.Unlock()
+
+					report.Killed = report.Interrupted
+					report.Duration = time.Since(start)
+					c.report(report)
+
+					return nil
+				}
+
+			case <-time.After(report.Timeout):
+			}
+		}
+	}
+
+	report.Killed = true
+
+	if err := c.Kill(); err != nil {
+		return err
+	}
+
+	<-exited
+
+	err := c.killGroup()
+
+	report.Duration = time.Since(start)
+	c.report(report)
+
+	return err
+}
+
+// killGroup kills the processes left in the process group of the last process, and waits for them to exit.
+func (c *Command) killGroup() error {
+	if c.pgid == 0 || !groupAlive(c.pgid) {
+		return nil
+	}
+
+	if err := signalGroup(c.pgid, os.Kill); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+
+	if !waitGroup(c.pgid, groupKillTimeout) {
+		return fmt.Errorf("processes of group %d are still running after being killed", c.pgid)
+	}
+
+	return nil
+}
+
+// report calls the stop handler, if any.
+func (c *Command) report(r StopReport) {
+	if c.onStop != nil {
+		c.onStop(r)
+	}
+}
+
+// OnStop sets a handler called with how the process exited once it was stopped.
+func (c *Command) OnStop(h func(StopReport)) {
+	c.onStop = h
+}
+
+// Stop stops the running command, see StopOptions, and waits for it's process to exit.
+// a run that did not start it's process yet returns ErrStopped without starting it,
+// the runs called after Stop run as usual and are not waited for.
+func (c *Command) Stop() {
+	c.stopGeneration()
+}
+
+// stopGeneration stops the command like Stop, it returns the stop generation of the runs called since, see runUnlessStopped.
+func (c *Command) stopGeneration() int {
+	c.runMemAccess.Lock()
+	defer c.runMemAccess.Unlock()
+
+	c.stops++
+	c.closeDone()
+
+	stops := c.stops
+
+	for c.pendingRuns(stops) {
+		c.runsDone.Wait()
+	}
+
+	return stops
+}
+
+// pendingRuns reports whether runs registered before the stop generation are unfinished. the caller must hold runMemAccess.
+func (c *Command) pendingRuns(stops int) bool {
+	for gen := range c.runs {
+		if gen < stops {
+			return true
+		}
+	}
+
+	return false
+}
+
+// closeDone signals the current run to stop, if any. the caller must hold runMemAccess.
+func (c *Command) closeDone() {
+	if c.done != nil {
+		close(c.done)
+		c.done = nil
+	}
+}
+
+// Kill terminates the command, it's underlying process & it's descendants if it is still running.
+// a running Stop is cut short, the process is reported as killed.
+func (c *Command) Kill() error {
+	c.runMemAccess.Lock()
+	pid := c.pid
+	c.killed = pid != 0
+	c.runMemAccess.Unlock()
+
+	if pid == 0 {
+		return nil
+	}
+
+	if err := signalGroup(pid, os.Kill); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+
+	return nil
+}
+
+// IsActive checks if the command is still running
+func (c *Command) IsActive() bool {
+	c.runMemAccess.Lock()
+	defer c.runMemAccess.Unlock()
+
+	// this field is alway set when the process starts and zero when it exits
+	return c.pid != 0
+}
+
+// PipeStdOut writes the command's output lines to stdout, prefixed with the output prefix.
+func (c *Command) PipeStdOut(stdout io.Writer) error {
+	w := newPrefixWriter(stdout, c.prefix())
+
+	c.cmd.Stdout = w
+	c.outputs = append(c.outputs, w)
+
+	return nil
+}
+
+// PipeStdErr writes the command's error output lines to stderr, prefixed with the output prefix.
+func (c *Command) PipeStdErr(stderr io.Writer) error {
+	w := newPrefixWriter(stderr, c.prefix())
+
+	c.cmd.Stderr = w
+	c.outputs = append(c.outputs, w)
+
+	return nil
+}
+
+// prefix returns the prefix of the output lines.
+func (c *Command) prefix() string {
+	prefix := c.outPrefix
+
+	if prefix != "" && !strings.HasSuffix(prefix, ":") {
+		prefix += ":"
+	}
+
+	if prefix != "" && c.outColor != nil {
+		return c.outColor.Sprint(prefix)
+	}
+
+	return prefix
+}
@@ -0,0 +1,282 @@
+//go:build !windows
+
+package runner_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/huboh/gwatch/internal/pkg/runner"
+)
+
+// runCommand runs the command until it's stopped, it returns the stop report and the Run error.
+func runCommand(t *testing.T, cmd *runner.Command) (runner.StopReport, error) {
+	t.Helper()
+
+	var (
+		report = runner.StopReport{}
+		exited = make(chan error, 1)
+	)
+
+	cmd.OnStop(func(r runner.StopReport) { report = r })
+
+	go func() { exited <- cmd.Run(io.Discard, io.Discard, nil) }()
+
+	// gives the shell the time to set it's traps
+	time.Sleep(time.Millisecond * 200)
+
+	stopped := make(chan struct{})
+
+	go func() {
+		cmd.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected Stop to return")
+	}
+
+	select {
+	case err := <-exited:
+		return report, err
+
+	case <-time.After(time.Second):
+		t.Fatal("expected Run to return once stopped")
+	}
+
+	return report, nil
+}
+
+func TestCommandStop(t *testing.T) {
+	testData := []struct {
+		name   string
+		args   []string
+		killed bool
+		report string
+	}{
+		{
+			name:   "exits on the signal",
+			args:   []string{"sleep", "30"},
+			killed: false,
+			report: "exited on SIGTERM",
+		},
+		{
+			name:   "ignores the signal",
+			args:   []string{"sh", "-c", `trap "" TERM; sleep 30`},
+			killed: true,
+			report: "killed, it did not exit within 300ms of SIGTERM",
+		},
+	}
+
+	for _, td := range testData {
+		t.Run(td.name, func(t *testing.T) {
+			cmd := runner.NewCommand(
+				runner.CommandLine{Args: td.args},
+				"",
+				runner.StopOptions{Signal: syscall.SIGTERM, Timeout: time.Millisecond * 300},
+			)
+
+			report, err := runCommand(t, cmd)
+
+			if !errors.Is(err, runner.ErrStopped) {
+				t.Errorf("expected ErrStopped got %v\n", err)
+			}
+
+			if report.Killed != td.killed {
+				t.Errorf("expected killed to be %v got %v\n", td.killed, report.Killed)
+			}
+
+			if !strings.HasPrefix(report.String(), td.report) {
+				t.Errorf("expected report %q got %q\n", td.report, report)
+			}
+		})
+	}
+}
+
+func TestStopBeforeStart(t *testing.T) {
+	cmd := runner.NewCommand(
+		runner.CommandLine{Args: []string{"sleep", "30"}},
+		"",
+		runner.StopOptions{Signal: syscall.SIGTERM, Timeout: time.Second},
+	)
+
+	var (
+		stopped = make(chan struct{})
+		exited  = make(chan error, 1)
+	)
+
+	// stops the command while Run holds it, before it's process is started
+	onRun := func() {
+		go func() {
+			cmd.Stop()
+			close(stopped)
+		}()
+
+		time.Sleep(time.Millisecond * 100)
+	}
+
+	go func() { exited <- cmd.Run(io.Discard, io.Discard, onRun) }()
+
+	select {
+	case err := <-exited:
+		if !errors.Is(err, runner.ErrStopped) {
+			t.Errorf("expected ErrStopped got %v\n", err)
+		}
+
+	case <-time.After(time.Second * 3):
+		t.Fatal("expected Run to return once stopped")
+	}
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("expected Stop to return")
+	}
+}
+
+func TestStopPendingRun(t *testing.T) {
+	cmd := runner.NewCommand(
+		runner.CommandLine{Args: []string{"sh", "-c", `trap "" TERM; sleep 30`}},
+		"",
+		runner.StopOptions{Signal: syscall.SIGTERM, Timeout: time.Millisecond * 500},
+	)
+
+	var (
+		started = make(chan string, 3)
+		stopped = make(chan struct{})
+	)
+
+	// run runs the command in the background, it returns the channel receiving the Run error
+	run := func(name string) <-chan error {
+		exited := make(chan error, 1)
+		go func() { exited <- cmd.Run(io.Discard, io.Discard, func() { started <- name }) }()
+
+		return exited
+	}
+
+	// wait ensures the run returned ErrStopped within the timeout
+	wait := func(name string, exited <-chan error, timeout time.Duration) {
+		t.Helper()
+
+		select {
+		case err := <-exited:
+			if !errors.Is(err, runner.ErrStopped) {
+				t.Errorf("%s: expected ErrStopped got %v\n", name, err)
+			}
+
+		case <-time.After(timeout):
+			t.Fatalf("%s: expected the run to return\n", name)
+		}
+	}
+
+	// expectStart ensures the run started it's process next
+	expectStart := func(name string) {
+		t.Helper()
+
+		select {
+		case n := <-started:
+			if n != name {
+				t.Fatalf("expected the %s run to start got the %s run\n", name, n)
+			}
+
+		case <-time.After(time.Second * 2):
+			t.Fatalf("expected the %s run to start\n", name)
+		}
+	}
+
+	// the first run ignores the stop signal, the pending run waits for it while it's stopped
+	first := run("first")
+	expectStart("first")
+	time.Sleep(time.Millisecond * 200)
+
+	pending := run("pending")
+	time.Sleep(time.Millisecond * 50)
+
+	go func() {
+		cmd.Stop()
+		close(stopped)
+	}()
+
+	// the run called after Stop is not stopped, and Stop doesn't wait for it
+	time.Sleep(time.Millisecond * 50)
+	after := run("after")
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second * 3):
+		t.Fatal("expected Stop to return once the first run exited")
+	}
+
+	wait("first", first, time.Second)
+	wait("pending", pending, time.Second)
+	expectStart("after")
+
+	cmd.Stop()
+	wait("after", after, time.Second*2)
+}
+
+func TestStopProcessGroup(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "pid")
+
+	cmd := runner.NewCommand(
+		runner.CommandLine{Args: []string{"sh", "-c", `echo $$ > "$0"; sleep 60 & wait`, pidFile}},
+		"",
+		runner.StopOptions{Signal: syscall.SIGTERM, Timeout: time.Second},
+	)
+
+	if _, err := runCommand(t, cmd); !errors.Is(err, runner.ErrStopped) {
+		t.Errorf("expected ErrStopped got %v\n", err)
+	}
+
+	content, err := os.ReadFile(pidFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := syscall.Kill(-pid, 0); !errors.Is(err, syscall.ESRCH) {
+		t.Errorf("expected the process group %d to be gone got %v\n", pid, err)
+	}
+}
+
+func TestKillDuringStop(t *testing.T) {
+	cmd := runner.NewCommand(
+		runner.CommandLine{Args: []string{"sh", "-c", `trap "" TERM; sleep 30`}},
+		"",
+		runner.StopOptions{Signal: syscall.SIGTERM, Timeout: time.Second * 10},
+	)
+
+	// kills the command while it's given the stop timeout, like a second interrupt
+	go func() {
+		time.Sleep(time.Millisecond * 400)
+
+		if err := cmd.Kill(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	report, err := runCommand(t, cmd)
+
+	if !errors.Is(err, runner.ErrStopped) {
+		t.Errorf("expected ErrStopped got %v\n", err)
+	}
+
+	if !report.Killed || !report.Interrupted || report.Duration >= report.Timeout {
+		t.Errorf("expected the stop to be interrupted by the kill got %q\n", report)
+	}
+}
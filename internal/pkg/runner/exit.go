@@ -0,0 +1,62 @@
+package runner
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// RestartNever never starts the process again once it exited on it's own.
+	RestartNever = "never"
+
+	// RestartOnFailure starts the process again once it exited on it's own with an error.
+	RestartOnFailure = "on-failure"
+
+	// RestartAlways starts the process again once it exited on it's own, whether it failed or not.
+	RestartAlways = "always"
+)
+
+// restartDelay is how long a process waits before it's started again, so a process failing on start doesn't spin.
+var restartDelay = time.Second
+
+// ExitReport is how a process exited on it's own, without being stopped.
+type ExitReport struct {
+	// Process is the name of the exited process, it's empty for the application of the run config
+	Process string
+
+	// Err is the reason the process failed, usually an *exec.ExitError, it's nil if it exited successfully
+	Err error
+
+	// Duration is how long the process ran
+	Duration time.Duration
+
+	// RestartIn is the delay before the process is started again, it's zero if it's not restarted
+	RestartIn time.Duration
+}
+
+func (r ExitReport) String() string {
+	report := fmt.Sprintf("exited after %s", r.Duration.Round(time.Millisecond))
+
+	if r.Err != nil {
+		report += ": " + r.Err.Error()
+	}
+
+	if r.RestartIn > 0 {
+		report += fmt.Sprintf(", restarting in %s", r.RestartIn)
+	}
+
+	return report
+}
+
+// restartPolicy returns the restart policy named name, RestartNever if it's empty.
+func restartPolicy(name string) (string, error) {
+	switch name {
+	case RestartNever, RestartOnFailure, RestartAlways:
+		return name, nil
+
+	case "":
+		return RestartNever, nil
+	}
+
+	return "", fmt.Errorf("unknown restart policy %q, expected %s, %s or %s", name, RestartNever, RestartOnFailure, RestartAlways)
+}
@@ -0,0 +1,11 @@
+package runner
+
+import "time"
+
+// SetRestartDelay replaces the delay before the processes are restarted, it returns a function restoring it.
+func SetRestartDelay(d time.Duration) (restore func()) {
+	previous := restartDelay
+	restartDelay = d
+
+	return func() { restartDelay = previous }
+}
@@ -0,0 +1,63 @@
+package runner
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// prefixWriter writes the lines of a command's output with a prefix, like `app: listening on :8080`.
+type prefixWriter struct {
+	// w is where the prefixed lines are written to
+	w io.Writer
+
+	// prefix is the prefix of the lines
+	prefix string
+
+	// buf is the last line written, until it's terminated by a newline
+	buf []byte
+
+	// bufMemAccess prevent concurrent access to buf
+	bufMemAccess *sync.Mutex
+}
+
+func newPrefixWriter(w io.Writer, prefix string) *prefixWriter {
+	return &prefixWriter{
+		w:            w,
+		prefix:       prefix,
+		bufMemAccess: new(sync.Mutex),
+	}
+}
+
+// Write writes the complete lines of b, the last one is kept until it's terminated or Flush is called.
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.bufMemAccess.Lock()
+	defer p.bufMemAccess.Unlock()
+
+	p.buf = append(p.buf, b...)
+
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+
+		if i < 0 {
+			break
+		}
+
+		fmt.Fprintln(p.w, p.prefix, string(bytes.TrimSuffix(p.buf[:i], []byte("\r"))))
+		p.buf = p.buf[i+1:]
+	}
+
+	return len(b), nil
+}
+
+// Flush writes the last line, if it was not terminated by a newline.
+func (p *prefixWriter) Flush() {
+	p.bufMemAccess.Lock()
+	defer p.bufMemAccess.Unlock()
+
+	if len(p.buf) > 0 {
+		fmt.Fprintln(p.w, p.prefix, string(p.buf))
+		p.buf = nil
+	}
+}
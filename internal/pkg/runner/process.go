@@ -0,0 +1,176 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fatih/color"
+	"github.com/huboh/gwatch/internal/pkg/config"
+	"github.com/huboh/gwatch/internal/pkg/gomod"
+)
+
+// prefixColors is the colors the log prefix of a process can be written with.
+var prefixColors = map[string]color.Attribute{
+	"red":     color.FgHiRed,
+	"cyan":    color.FgHiCyan,
+	"blue":    color.FgHiBlue,
+	"white":   color.FgHiWhite,
+	"green":   color.FgHiGreen,
+	"yellow":  color.FgHiYellow,
+	"magenta": color.FgHiMagenta,
+}
+
+// process is an application built & run by the runner.
+type process struct {
+	// name is the name the process is reported with, it's empty for the application of the run config
+	name string
+
+	// target is the package pattern the process is built from, it's empty if it's unknown
+	target string
+
+	// bin is the binary run by the process
+	bin string
+
+	// build is the build steps of the process
+	build []*step
+
+	// cmd is the command running the binary
+	cmd *Command
+
+	// restart is the restart policy, one of RestartNever, RestartOnFailure or RestartAlways
+	restart string
+
+	// deps is the set of the local package directories the process is built from, it's nil until they're listed
+	deps map[string]bool
+
+	// depsMemAccess prevent concurrent access to deps
+	depsMemAccess *sync.RWMutex
+}
+
+// newProcess creates the process of the process config, the run config holds the settings shared by the processes.
+func newProcess(cfg config.ProcessConfig, run config.RunConfig, stopOpts StopOptions) (*process, error) {
+	if cfg.Name == "" {
+		return nil, errors.New("invalid process: the name is empty")
+	}
+
+	if cfg.Target == "" {
+		return nil, fmt.Errorf("invalid process %s: the target is empty", cfg.Name)
+	}
+
+	bin := cfg.Bin
+
+	// named after the process, with the extension of the run binary, like `.exe` on windows
+	if bin == "" {
+		bin = filepath.Join(filepath.Dir(run.Bin), cfg.Name+filepath.Ext(run.Bin))
+	}
+
+	build := cfg.Build
+
+	if strings.TrimSpace(build.String()) == "" {
+		build = config.Command{Args: []string{"go", "build", "-o", bin, cfg.Target}}
+	}
+
+	outPrefix := cfg.LogPrefix
+
+	if outPrefix == "" {
+		outPrefix = cfg.Name
+	}
+
+	buildSteps, err := newSteps(StageBuild, []config.Step{{Name: cfg.Name + ": " + build.String(), Cmd: build}}, outPrefix)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid process %s: %w", cfg.Name, err)
+	}
+
+	runLine, err := commandLine(config.Command{Args: append([]string{bin}, cfg.Args...)}, run.Shell)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid process %s: %w", cfg.Name, err)
+	}
+
+	restart := cfg.Restart
+
+	if restart == "" {
+		restart = run.Restart
+	}
+
+	if restart, err = restartPolicy(restart); err != nil {
+		return nil, fmt.Errorf("invalid process %s: %w", cfg.Name, err)
+	}
+
+	p := &process{
+		name:          cfg.Name,
+		target:        cfg.Target,
+		bin:           bin,
+		build:         buildSteps,
+		cmd:           NewCommand(runLine, outPrefix, stopOpts),
+		restart:       restart,
+		depsMemAccess: new(sync.RWMutex),
+	}
+
+	if cfg.Color != "" {
+		attr, ok := prefixColors[strings.ToLower(cfg.Color)]
+
+		if !ok {
+			return nil, fmt.Errorf("invalid process %s: unknown color %q", cfg.Name, cfg.Color)
+		}
+
+		p.cmd.outColor = color.New(attr)
+
+		for _, s := range p.build {
+			s.cmd.outColor = p.cmd.outColor
+		}
+	}
+
+	return p, nil
+}
+
+// refreshDeps lists the local packages the process is built from with `go list`, run in dir.
+// it does nothing if the target of the process is unknown.
+func (p *process) refreshDeps(dir string) error {
+	if p.target == "" {
+		return nil
+	}
+
+	pkgs, err := gomod.Deps(dir, p.target)
+
+	if err != nil {
+		return err
+	}
+
+	deps := make(map[string]bool)
+
+	for _, pkg := range pkgs {
+		if pkg.IsLocal() {
+			deps[filepath.Clean(pkg.Dir)] = true
+		}
+	}
+
+	p.depsMemAccess.Lock()
+	defer p.depsMemAccess.Unlock()
+
+	p.deps = deps
+
+	return nil
+}
+
+// dependsOn reports whether the process may be built from the file. a go file outside of the packages the process
+// is built from is the only file it's known not to depend on, the other files can be embedded, read at runtime,
+// or change how the process is built (go.mod, go.work...).
+func (p *process) dependsOn(path string) bool {
+	p.depsMemAccess.RLock()
+	defer p.depsMemAccess.RUnlock()
+
+	if p.deps == nil || filepath.Ext(path) != ".go" {
+		return true
+	}
+
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+
+	return p.deps[filepath.Dir(path)]
+}
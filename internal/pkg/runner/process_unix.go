@@ -0,0 +1,54 @@
+//go:build !windows
+
+package runner
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// backslashEscapes reports whether a backslash quotes the next character of the command lines.
+const backslashEscapes = true
+
+// shellCommand returns the arguments running the command line through the shell.
+func shellCommand(line string) []string {
+	return []string{"sh", "-c", line}
+}
+
+// shellQuote quotes the argument in single quotes, closing them around an escaped quote for the single quotes it contains.
+func shellQuote(arg string) string {
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// setProcessGroup starts the command's process in a new process group, so it's descendants are signaled along with it.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// signalGroup sends the signal to the processes of the process group led by the process pid.
+// it returns os.ErrProcessDone if none of them is running.
+func signalGroup(pid int, sig os.Signal) error {
+	s, ok := sig.(syscall.Signal)
+
+	if !ok {
+		return errors.New("unsupported signal: " + sig.String())
+	}
+
+	err := syscall.Kill(-pid, s)
+
+	if errors.Is(err, syscall.ESRCH) {
+		return os.ErrProcessDone
+	}
+
+	return err
+}
+
+// groupAlive reports whether a process of the process group led by the process pid is still running.
+func groupAlive(pid int) bool {
+	err := syscall.Kill(-pid, 0)
+
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
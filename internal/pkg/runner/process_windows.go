@@ -0,0 +1,46 @@
+//go:build windows
+
+package runner
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// backslashEscapes reports whether a backslash quotes the next character of the command lines,
+// they're path separators on windows.
+const backslashEscapes = false
+
+// shellCommand returns the arguments running the command line through the shell.
+func shellCommand(line string) []string {
+	return []string{"cmd", "/C", line}
+}
+
+// shellQuote quotes the argument in double quotes, the double quotes it contains are doubled.
+func shellQuote(arg string) string {
+	return `"` + strings.ReplaceAll(arg, `"`, `""`) + `"`
+}
+
+// setProcessGroup starts the command's process in a new process group, so it's descendants are terminated along with it.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// signalGroup terminates the process tree of the process pid, windows can't send signals.
+// it returns os.ErrProcessDone if the process is not running.
+func signalGroup(pid int, sig os.Signal) error {
+	if err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(pid)).Run(); err != nil {
+		return os.ErrProcessDone
+	}
+
+	return nil
+}
+
+// groupAlive reports whether a process of the process tree of the process pid is still running.
+// the descendants of an exited process can't be found on windows, they were terminated along with it by signalGroup.
+func groupAlive(pid int) bool {
+	return false
+}
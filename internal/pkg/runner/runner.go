@@ -1,52 +1,441 @@
-// Package runner provides functionality for executing our build and run commands.
-package runner
-
-import (
-	"os"
-	"strings"
-
-	"github.com/huboh/gwatch/internal/pkg/config"
-)
-
-// Runner represents a runner for building and running go applications.
-type Runner struct {
-	// buildCmd is the build command to be executed
-	buildCmd *Command
-
-	// runBuildCmd is the command to run the compiled binary
-	runBuildCmd *Command
-}
-
-// New creates a new `*Runner` instance with the given configuration.
-func New(config config.Config) *Runner {
-	return &Runner{
-		buildCmd:    NewCommand(strings.Split(config.Build.Cmd, "\x20"), config.LogPrefix),
-		runBuildCmd: NewCommand(append([]string{config.Run.Bin}, config.Run.Args...), config.LogPrefix),
-	}
-}
-
-// Kill kills builds and runs process.
-func (r *Runner) Kill() error {
-	if err := r.buildCmd.Kill(); err != nil {
-		return err
-	}
-
-	if err := r.runBuildCmd.Kill(); err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// Launch builds and runs the application.
-func (r *Runner) Launch(onBuild func(), onRunBuild func()) error {
-	if err := r.buildCmd.Run(os.Stdout, os.Stderr, onBuild); err != nil {
-		return err
-	}
-
-	if err := r.runBuildCmd.Run(os.Stdout, os.Stderr, onRunBuild); err != nil {
-		return err
-	}
-
-	return nil
-}
+// Package runner provides functionality for executing our build and run commands.
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/huboh/gwatch/internal/pkg/config"
+)
+
+// Runner represents a runner for building and running go applications.
+//
+// a launch runs the pipeline: the before_build, build & after_build steps, then once the running application is
+// stopped & the after_stop steps ran, the before_run steps and the application.
+//
+// the application is either the binary of the run config, or the processes of the processes config. a launch only
+// builds & restarts the processes depending on the changed files, the go build cache compiles their shared packages once.
+type Runner struct {
+	// beforeBuild is the steps run before the build
+	beforeBuild []*step
+
+	// afterBuild is the steps run once the build succeeded
+	afterBuild []*step
+
+	// beforeRun is the steps run before each start of the application
+	beforeRun []*step
+
+	// afterStop is the steps run once the application was stopped
+	afterStop []*step
+
+	// processes is the processes of the application
+	processes []*process
+
+	// dir is the root directory the dependencies of the processes are listed in
+	dir string
+
+	// pending is the set of the processes a superseded launch did not start
+	pending map[*process]bool
+
+	// pendingMemAccess prevent concurrent access to pending
+	pendingMemAccess *sync.Mutex
+
+	// launches is the number of launches, a launch is superseded once it's not the last one
+	launches *atomic.Int64
+
+	// onStep is called with how each step ran
+	onStep func(StepReport)
+
+	// onExit is called with how each process exited on it's own
+	onExit func(ExitReport)
+}
+
+// New creates a new `*Runner` instance with the given configuration.
+func New(config config.Config) (*Runner, error) {
+	stopSignal, err := ParseSignal(config.Run.StopSignal)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		stopOpts = StopOptions{Signal: stopSignal, Timeout: config.Run.StopTimeout}
+		names    = make(map[string]bool)
+	)
+
+	r := &Runner{
+		dir:              config.Root,
+		pending:          make(map[*process]bool),
+		pendingMemAccess: new(sync.Mutex),
+		launches:         new(atomic.Int64),
+	}
+
+	for _, cfg := range config.Processes {
+		if names[cfg.Name] {
+			return nil, fmt.Errorf("invalid process %s: the name is already used", cfg.Name)
+		}
+
+		p, err := newProcess(cfg, config.Run, stopOpts)
+
+		if err != nil {
+			return nil, err
+		}
+
+		names[cfg.Name] = true
+		r.processes = append(r.processes, p)
+	}
+
+	// the application is the binary of the run config, unless processes are listed
+	if len(r.processes) == 0 {
+		runLine, err := commandLine(config.Run.Command(), config.Run.Shell)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid run command: %w", err)
+		}
+
+		build, err := newSteps(StageBuild, config.Build.BuildSteps(), config.LogPrefix)
+
+		if err != nil {
+			return nil, err
+		}
+
+		restart, err := restartPolicy(config.Run.Restart)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid run restart: %w", err)
+		}
+
+		r.processes = append(r.processes, &process{
+			bin:           config.Run.Bin,
+			build:         build,
+			cmd:           NewCommand(runLine, config.LogPrefix, stopOpts),
+			restart:       restart,
+			depsMemAccess: new(sync.RWMutex),
+		})
+	}
+
+	if r.beforeBuild, err = newSteps(StageBeforeBuild, config.Build.BeforeBuild, config.LogPrefix); err != nil {
+		return nil, err
+	}
+
+	if r.afterBuild, err = newSteps(StageAfterBuild, config.Build.AfterBuild, config.LogPrefix); err != nil {
+		return nil, err
+	}
+
+	if r.beforeRun, err = newSteps(StageBeforeRun, config.Run.BeforeRun, config.LogPrefix); err != nil {
+		return nil, err
+	}
+
+	if r.afterStop, err = newSteps(StageAfterStop, config.Run.AfterStop, config.LogPrefix); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// commandLine returns the command line of the configured command: run through the shell if shell is enabled,
+// the list of arguments as is, or the command line parsed with the shell quoting rules.
+// a list of arguments run through the shell is quoted, so it's arguments are passed as is too.
+func commandLine(cmd config.Command, shell bool) (CommandLine, error) {
+	switch {
+	case strings.TrimSpace(cmd.String()) == "":
+		return CommandLine{}, errors.New("the command is empty")
+
+	case shell && cmd.Args != nil:
+		return CommandLine{Args: shellCommand(JoinCommandLine(cmd.Args))}, nil
+
+	case shell:
+		return CommandLine{Args: shellCommand(cmd.Line)}, nil
+
+	case cmd.Args != nil:
+		return CommandLine{Args: cmd.Args}, nil
+	}
+
+	return ParseCommandLine(cmd.Line)
+}
+
+// Stop stops the pipeline & the processes, and waits for them to exit.
+// the steps are killed right away, the processes are given the run stop timeout to exit after the stop signal.
+func (r *Runner) Stop() {
+	r.launches.Add(1)
+	r.stopBuild()
+	r.stopApps(r.processes)
+}
+
+// Kill kills the running steps & processes right away, along with their descendants, cutting a running Stop short.
+func (r *Runner) Kill() error {
+	var errs []error
+
+	for _, s := range slices.Concat(r.beforeBuild, r.buildSteps(r.processes), r.afterBuild, r.beforeRun, r.afterStop) {
+		errs = append(errs, s.cmd.Kill())
+	}
+
+	for _, p := range r.processes {
+		errs = append(errs, p.cmd.Kill())
+	}
+
+	return errors.Join(errs...)
+}
+
+// stopBuild stops the running build steps.
+func (r *Runner) stopBuild() {
+	for _, s := range slices.Concat(r.beforeBuild, r.buildSteps(r.processes), r.afterBuild) {
+		s.cmd.Stop()
+	}
+}
+
+// buildSteps returns the build steps of the processes.
+func (r *Runner) buildSteps(processes []*process) []*step {
+	var steps []*step
+
+	for _, p := range processes {
+		steps = append(steps, p.build...)
+	}
+
+	return steps
+}
+
+// stopApps stops the running processes together, then runs the after_stop steps if any of them was running.
+// it returns the stop generation of each process, so a process stopped again in the meantime is not run.
+func (r *Runner) stopApps(processes []*process) []int {
+	var (
+		wg      sync.WaitGroup
+		stopped bool
+		stops   = make([]int, len(processes))
+	)
+
+	// the processes not started yet are stopped too, they're waiting for the previous run to exit
+	for i, p := range processes {
+		stopped = stopped || p.cmd.IsActive()
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			stops[i] = p.cmd.stopGeneration()
+		}()
+	}
+
+	wg.Wait()
+
+	if stopped {
+		r.runSteps(0, r.afterStop)
+	}
+
+	return stops
+}
+
+// OnStop sets a handler called with how each process exited once it was stopped, on rebuilds or by Stop.
+func (r *Runner) OnStop(h func(StopReport)) {
+	for _, p := range r.processes {
+		p.cmd.OnStop(func(report StopReport) {
+			report.Process = p.name
+			h(report)
+		})
+	}
+}
+
+// OnStep sets a handler called with how each step of the pipeline ran, once it's done.
+func (r *Runner) OnStep(h func(StepReport)) {
+	r.onStep = h
+}
+
+// OnExit sets a handler called with how each process exited on it's own, and whether it's restarted.
+func (r *Runner) OnExit(h func(ExitReport)) {
+	r.onExit = h
+}
+
+// HasBuild reports whether the binaries to run exist.
+func (r *Runner) HasBuild() bool {
+	return !slices.ContainsFunc(r.processes, func(p *process) bool {
+		_, err := os.Stat(p.bin)
+		return err != nil
+	})
+}
+
+// RunBuild runs the previously built processes without building them.
+func (r *Runner) RunBuild(onRunBuild func()) error {
+	launch := r.launches.Add(1)
+
+	r.refreshDeps(r.processes)
+
+	return r.runApps(launch, r.processes, onRunBuild)
+}
+
+// Launch builds and runs the processes depending on the changed files, superseding the running launch.
+// every process is launched if changed is nil.
+//
+// a failed step is reported to the step handler, and aborts the launch if it's failure policy is FailureAbort.
+func (r *Runner) Launch(changed []string, onBuild func(), onRunBuild func()) error {
+	launch := r.launches.Add(1)
+
+	// the build of the superseded launch is outdated
+	r.stopBuild()
+
+	processes := r.affected(changed)
+
+	if len(processes) == 0 {
+		return nil
+	}
+
+	if onBuild != nil {
+		onBuild()
+	}
+
+	if !r.runSteps(launch, slices.Concat(r.beforeBuild, r.buildSteps(processes), r.afterBuild)) {
+		return nil
+	}
+
+	// the imports may have changed
+	r.refreshDeps(processes)
+
+	return r.runApps(launch, processes, onRunBuild)
+}
+
+// affected returns the processes to launch for the changed files: the processes depending on them, along with the
+// ones the superseded launches did not start. every process is affected if changed is nil.
+func (r *Runner) affected(changed []string) []*process {
+	r.pendingMemAccess.Lock()
+	defer r.pendingMemAccess.Unlock()
+
+	for _, p := range r.processes {
+		if changed == nil || slices.ContainsFunc(changed, p.dependsOn) {
+			r.pending[p] = true
+		}
+	}
+
+	return slices.DeleteFunc(slices.Clone(r.processes), func(p *process) bool {
+		return !r.pending[p]
+	})
+}
+
+// refreshDeps lists the packages the processes are built from, a process keeps it's previous packages if they can't be listed.
+func (r *Runner) refreshDeps(processes []*process) {
+	var wg sync.WaitGroup
+
+	for _, p := range processes {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			p.refreshDeps(r.dir)
+		}()
+	}
+
+	wg.Wait()
+}
+
+// runApps stops the processes, runs the before_run steps then the processes until they exit or are stopped.
+func (r *Runner) runApps(launch int64, processes []*process, onRunBuild func()) error {
+	if r.launches.Load() != launch {
+		return nil
+	}
+
+	stops := r.stopApps(processes)
+
+	// superseded or stopped while the processes were stopped, or while the before_run steps ran
+	if !r.runSteps(launch, r.beforeRun) || r.launches.Load() != launch {
+		return nil
+	}
+
+	r.pendingMemAccess.Lock()
+
+	for _, p := range processes {
+		delete(r.pending, p)
+	}
+
+	r.pendingMemAccess.Unlock()
+
+	if onRunBuild != nil {
+		onRunBuild()
+	}
+
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, len(processes))
+	)
+
+	for i, p := range processes {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			errs[i] = r.runProcess(p, stops[i])
+		}()
+	}
+
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// runProcess runs the process until it's stopped or exits on it's own, and starts it again after the restart delay if
+// it's restart policy says so. each exit is reported to the exit handler. the process exiting on it's own, or being
+// stopped for a rebuild, is not a runner error.
+//
+// stops is the stop generation returned by stopApps, the process is not run, nor restarted, once it's stopped again,
+// for a rebuild or by Stop.
+func (r *Runner) runProcess(p *process, stops int) error {
+	for {
+		start := time.Now()
+		err := p.cmd.runUnlessStopped(stops, os.Stdout, os.Stderr)
+
+		if errors.Is(err, ErrStopped) {
+			return nil
+		}
+
+		if err != nil && !errors.As(err, new(*exec.ExitError)) {
+			return err
+		}
+
+		restart := p.restart == RestartAlways || p.restart == RestartOnFailure && err != nil
+		report := ExitReport{Process: p.name, Err: err, Duration: time.Since(start)}
+
+		if restart {
+			report.RestartIn = restartDelay
+		}
+
+		if r.onExit != nil {
+			r.onExit(report)
+		}
+
+		if !restart {
+			return nil
+		}
+
+		time.Sleep(restartDelay)
+	}
+}
+
+// runSteps runs the steps in order, reporting each of them to the step handler. it reports false if the launch must not
+// go on: a step failed with FailureAbort, was stopped, or the launch was superseded. a zero launch is never superseded.
+func (r *Runner) runSteps(launch int64, steps []*step) bool {
+	for _, s := range steps {
+		if launch != 0 && r.launches.Load() != launch {
+			return false
+		}
+
+		start := time.Now()
+		err := s.cmd.Run(os.Stdout, os.Stderr, nil)
+
+		if errors.Is(err, ErrStopped) {
+			return false
+		}
+
+		if r.onStep != nil {
+			r.onStep(StepReport{Stage: s.stage, Name: s.name, Duration: time.Since(start), Err: err, OnFailure: s.onFailure})
+		}
+
+		if err != nil && s.onFailure == FailureAbort {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,449 @@
+//go:build !windows
+
+package runner_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/huboh/gwatch/internal/pkg/config"
+	"github.com/huboh/gwatch/internal/pkg/runner"
+)
+
+// logStep returns a step writing it's name to the log file, and failing if fail is true.
+func logStep(log string, name string, fail bool, onFailure string) config.Step {
+	line := "echo " + name + " >> " + log
+
+	if fail {
+		line += "; exit 1"
+	}
+
+	return config.Step{Name: name, Cmd: config.Command{Line: line}, Shell: true, OnFailure: onFailure}
+}
+
+// readLog returns the names written to the log file.
+func readLog(t *testing.T, log string) []string {
+	t.Helper()
+
+	content, err := os.ReadFile(log)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return strings.Fields(string(content))
+}
+
+func TestSteps(t *testing.T) {
+	testData := []struct {
+		onFailure string
+		ran       []string
+		reports   int
+		report    string
+	}{
+		{
+			onFailure: runner.FailureAbort,
+			ran:       []string{"generate", "lint"},
+			reports:   2,
+			report:    "before_build: lint failed in 0s: exit status 1, aborting",
+		},
+		{
+			onFailure: runner.FailureWarn,
+			ran:       []string{"generate", "lint", "vet", "build", "embed", "migrate", "app"},
+			reports:   6,
+			report:    "before_build: lint failed in 0s: exit status 1, continuing with a warning",
+		},
+		{
+			onFailure: runner.FailureContinue,
+			ran:       []string{"generate", "lint", "vet", "build", "embed", "migrate", "app"},
+			reports:   6,
+			report:    "before_build: lint failed in 0s: exit status 1, continuing",
+		},
+	}
+
+	for _, td := range testData {
+		t.Run(td.onFailure, func(t *testing.T) {
+			log := filepath.Join(t.TempDir(), "steps.log")
+
+			cfg := config.Default()
+			cfg.Build.BeforeBuild = []config.Step{
+				logStep(log, "generate", false, ""),
+				logStep(log, "lint", true, td.onFailure),
+				logStep(log, "vet", false, ""),
+			}
+			cfg.Build.Cmd = config.Command{Args: []string{"sh", "-c", "echo build >> " + log}}
+			cfg.Build.AfterBuild = []config.Step{logStep(log, "embed", false, "")}
+			cfg.Run.BeforeRun = []config.Step{logStep(log, "migrate", false, "")}
+			cfg.Run.Bin = "sh"
+			cfg.Run.Args = []string{"-c", "echo app >> " + log}
+
+			r, err := runner.New(*cfg)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var reports []runner.StepReport
+
+			r.OnStep(func(report runner.StepReport) {
+				report.Duration = 0
+				reports = append(reports, report)
+			})
+
+			if err := r.Launch(nil, nil, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			if ran := readLog(t, log); !slices.Equal(ran, td.ran) {
+				t.Errorf("expected the steps %v to run got %v\n", td.ran, ran)
+			}
+
+			// every step that ran is reported, the app is not a step
+			if len(reports) != td.reports {
+				t.Fatalf("expected %d step reports got %v\n", td.reports, reports)
+			}
+
+			if report := reports[1].String(); report != td.report {
+				t.Errorf("expected the report %q got %q\n", td.report, report)
+			}
+
+			if report := reports[0].String(); report != "before_build: generate done in 0s" {
+				t.Errorf("expected the generate step to be done got %q\n", report)
+			}
+		})
+	}
+}
+
+func TestRestart(t *testing.T) {
+	defer runner.SetRestartDelay(time.Millisecond * 50)()
+
+	testData := []struct {
+		restart string
+		status  int
+		report  string
+		runs    int
+	}{
+		{restart: runner.RestartNever, status: 1, report: "exited after 0s: exit status 1", runs: 1},
+		{restart: runner.RestartOnFailure, status: 0, report: "exited after 0s", runs: 1},
+		{restart: runner.RestartOnFailure, status: 2, report: "exited after 0s: exit status 2, restarting in 50ms", runs: 3},
+		{restart: runner.RestartAlways, status: 0, report: "exited after 0s, restarting in 50ms", runs: 3},
+	}
+
+	for _, td := range testData {
+		t.Run(fmt.Sprintf("%s exit %d", td.restart, td.status), func(t *testing.T) {
+			log := filepath.Join(t.TempDir(), "runs.log")
+
+			cfg := config.Default()
+			cfg.Build.Cmd = config.Command{Args: []string{"true"}}
+			cfg.Run.Bin = "sh"
+			cfg.Run.Args = []string{"-c", fmt.Sprintf("echo run >> %s; exit %d", log, td.status)}
+			cfg.Run.Restart = td.restart
+
+			r, err := runner.New(*cfg)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			reports := make(chan runner.ExitReport, 10)
+
+			r.OnExit(func(report runner.ExitReport) {
+				report.Duration = 0
+
+				select {
+				case reports <- report:
+				default:
+				}
+			})
+
+			launched := make(chan error, 1)
+			go func() { launched <- r.Launch(nil, nil, nil) }()
+
+			for i := range td.runs {
+				select {
+				case report := <-reports:
+					if report.String() != td.report {
+						t.Errorf("run %d: expected the report %q got %q\n", i+1, td.report, report)
+					}
+
+				case <-time.After(time.Second * 2):
+					t.Fatalf("expected %d runs got %d\n", td.runs, i)
+				}
+			}
+
+			// the restarts stop along with the process
+			r.Stop()
+
+			select {
+			case err := <-launched:
+				if err != nil {
+					t.Error(err)
+				}
+
+			case <-time.After(time.Second):
+				t.Fatal("expected the launch to return once stopped")
+			}
+
+			runs := len(readLog(t, log))
+			time.Sleep(time.Millisecond * 150)
+
+			if after := len(readLog(t, log)); after != runs || runs < td.runs {
+				t.Errorf("expected %d runs and no restart once stopped got %d then %d\n", td.runs, runs, after)
+			}
+		})
+	}
+}
+
+func TestStopDuringRelaunch(t *testing.T) {
+	log := filepath.Join(t.TempDir(), "runs.log")
+
+	cfg := config.Default()
+	cfg.Build.Cmd = config.Command{Args: []string{"true"}}
+	cfg.Run.Bin = "sh"
+	cfg.Run.Args = []string{"-c", fmt.Sprintf(`echo run >> %s; trap "" TERM; sleep 30`, log)}
+	cfg.Run.StopTimeout = time.Second
+
+	r, err := runner.New(*cfg)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		launched   = make(chan error, 2)
+		stopped    = make(chan struct{})
+		waitLaunch = func(name string) {
+			t.Helper()
+
+			select {
+			case err := <-launched:
+				if err != nil {
+					t.Errorf("%s launch: %v\n", name, err)
+				}
+
+			case <-time.After(time.Second * 3):
+				t.Fatalf("expected the %s launch to return once stopped\n", name)
+			}
+		}
+	)
+
+	go func() { launched <- r.Launch(nil, nil, nil) }()
+
+	for deadline := time.Now().Add(time.Second * 2); len(readLog(t, log)) == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	// the relaunch waits for the app ignoring the stop signal when Stop is called
+	go func() { launched <- r.Launch(nil, nil, nil) }()
+	time.Sleep(time.Millisecond * 300)
+
+	go func() {
+		r.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected Stop to return")
+	}
+
+	waitLaunch("first")
+	waitLaunch("second")
+
+	// the relaunch did not start the app again
+	if runs := readLog(t, log); len(runs) != 1 {
+		t.Errorf("expected the app to run once got %d runs\n", len(runs))
+	}
+}
+
+// writeModule creates a module with an api & a worker built from their own packages, and a shared one.
+func writeModule(t *testing.T, root string) {
+	t.Helper()
+
+	files := map[string]string{
+		"go.mod":                    "module example.com/app\n\ngo 1.22\n",
+		"cmd/api/main.go":           "package main\n\nimport _ \"example.com/app/internal/api\"\n\nfunc main() {}\n",
+		"cmd/worker/main.go":        "package main\n\nimport _ \"example.com/app/internal/jobs\"\n\nfunc main() {}\n",
+		"internal/api/api.go":       "package api\n\nimport _ \"example.com/app/internal/shared\"\n",
+		"internal/jobs/jobs.go":     "package jobs\n\nimport _ \"example.com/app/internal/shared\"\n",
+		"internal/shared/shared.go": "package shared\n",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// processesConfig returns the config of the api & worker processes of the module, their builds wait for buildTime.
+// the builds & runs are written to the log file.
+func processesConfig(root string, log string, buildTime time.Duration) *config.Config {
+	cfg := config.Default()
+	cfg.Root = root
+
+	for _, name := range []string{"api", "worker"} {
+		cfg.Processes = append(cfg.Processes, config.ProcessConfig{
+			Name:   name,
+			Target: "./cmd/" + name,
+			Build:  config.Command{Args: []string{"sh", "-c", fmt.Sprintf("sleep %g; echo build-%s >> %s", buildTime.Seconds(), name, log)}},
+			Bin:    "sh",
+			Args:   []string{"-c", fmt.Sprintf("echo run-%s >> %s", name, log)},
+		})
+	}
+
+	return cfg
+}
+
+func TestAffectedProcesses(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not installed")
+	}
+
+	root := t.TempDir()
+	log := filepath.Join(t.TempDir(), "launches.log")
+
+	writeModule(t, root)
+
+	r, err := runner.New(*processesConfig(root, log, 0))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testData := []struct {
+		name     string
+		changed  []string
+		launched []string
+	}{
+		{
+			name:     "first launch",
+			changed:  nil,
+			launched: []string{"api", "worker"},
+		},
+		{
+			name:     "package of a process",
+			changed:  []string{"internal/api/api.go"},
+			launched: []string{"api"},
+		},
+		{
+			name:     "main package of a process",
+			changed:  []string{"cmd/worker/main.go"},
+			launched: []string{"worker"},
+		},
+		{
+			name:     "shared package",
+			changed:  []string{"internal/shared/shared.go"},
+			launched: []string{"api", "worker"},
+		},
+		{
+			name:     "go file outside the processes packages",
+			changed:  []string{"tools/gen.go"},
+			launched: nil,
+		},
+		{
+			name:     "other file",
+			changed:  []string{"templates/index.html"},
+			launched: []string{"api", "worker"},
+		},
+	}
+
+	for _, td := range testData {
+		if err := os.Remove(log); err != nil && !errors.Is(err, os.ErrNotExist) {
+			t.Fatal(err)
+		}
+
+		var changed []string
+
+		for _, name := range td.changed {
+			changed = append(changed, filepath.Join(root, filepath.FromSlash(name)))
+		}
+
+		if err := r.Launch(changed, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		var expected []string
+
+		for _, name := range td.launched {
+			expected = append(expected, "build-"+name, "run-"+name)
+		}
+
+		if launched := readLog(t, log); !sameItems(launched, expected) {
+			t.Errorf("%s: expected %v got %v\n", td.name, expected, launched)
+		}
+	}
+}
+
+func TestSupersededLaunch(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not installed")
+	}
+
+	root := t.TempDir()
+	log := filepath.Join(t.TempDir(), "launches.log")
+
+	writeModule(t, root)
+
+	r, err := runner.New(*processesConfig(root, log, time.Millisecond*300))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// lists the packages of the processes
+	if err := r.Launch(nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(log); err != nil {
+		t.Fatal(err)
+	}
+
+	// the api launch is superseded during it's build, the api is launched along with the worker by the next launch
+	superseded := make(chan error, 1)
+	go func() { superseded <- r.Launch([]string{filepath.Join(root, "internal", "api", "api.go")}, nil, nil) }()
+
+	time.Sleep(time.Millisecond * 100)
+
+	if err := r.Launch([]string{filepath.Join(root, "internal", "jobs", "jobs.go")}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-superseded; err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"build-api", "build-worker", "run-api", "run-worker"}
+
+	if launched := readLog(t, log); !sameItems(launched, expected) {
+		t.Errorf("expected %v got %v\n", expected, launched)
+	}
+}
+
+// sameItems reports whether a & b have the same items, in any order.
+func sameItems(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+
+	return slices.Equal(a, b)
+}
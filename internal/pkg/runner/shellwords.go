@@ -0,0 +1,298 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// ErrShellSyntax is returned when parsing a command line using shell features that need a shell to run it,
+	// like pipes, redirections, command substitutions or lists of commands.
+	ErrShellSyntax = errors.New("the command uses shell syntax, set `shell: true` to run it through the shell")
+)
+
+// CommandLine is a parsed command line: the program & it's arguments, along with the environment variables assigned before them.
+type CommandLine struct {
+	// Env is the list of the `NAME=value` assignments before the program
+	Env []string
+
+	// Args is the program & it's arguments
+	Args []string
+}
+
+// ParseCommandLine splits the command line into words following the POSIX shell quoting rules:
+//
+//   - words are separated by unquoted blanks & newlines.
+//   - a backslash quotes the next character, and a backslash-newline is a line continuation.
+//   - single quotes preserve the literal value of the characters in between.
+//   - double quotes preserve the literal value of the characters in between, except `$` and the backslash
+//     quoting `$`, `"`, `\` or a newline.
+//   - `$NAME` & `${NAME}` are expanded from the environment, outside of single quotes.
+//   - a `#` starting a word starts a comment, up to the end of the line.
+//
+// on windows, backslashes are path separators: they never quote the next character.
+//
+// the `NAME=value` words before the program are returned as it's environment variables. the command lines using
+// pipes, redirections, command substitutions or lists of commands return ErrShellSyntax, they must be run by a shell.
+func ParseCommandLine(s string) (CommandLine, error) {
+	var (
+		cmdLine CommandLine
+		p       = &lineParser{line: s}
+	)
+
+	for {
+		word, isAssign, ok, err := p.next()
+
+		if err != nil {
+			return CommandLine{}, fmt.Errorf("error parsing command %q: %w", s, err)
+		}
+
+		if !ok {
+			break
+		}
+
+		if isAssign && len(cmdLine.Args) == 0 {
+			cmdLine.Env = append(cmdLine.Env, word)
+		} else {
+			cmdLine.Args = append(cmdLine.Args, word)
+		}
+	}
+
+	if len(cmdLine.Args) == 0 {
+		return CommandLine{}, fmt.Errorf("error parsing command %q: no program to run", s)
+	}
+
+	return cmdLine, nil
+}
+
+// JoinCommandLine returns the command line running the arguments as they are through the shell,
+// each one is quoted unless it's only made of letters, digits & `_@%+:,./-`.
+func JoinCommandLine(args []string) string {
+	words := make([]string, len(args))
+
+	for i, arg := range args {
+		words[i] = arg
+
+		if arg == "" || strings.ContainsFunc(arg, isSpecialRune) {
+			words[i] = shellQuote(arg)
+		}
+	}
+
+	return strings.Join(words, " ")
+}
+
+// isSpecialRune reports whether r has a special meaning for the shell, or might have one.
+func isSpecialRune(r rune) bool {
+	return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || strings.ContainsRune("_@%+:,./-", r))
+}
+
+// lineParser reads the words of a command line.
+type lineParser struct {
+	// line is the command line
+	line string
+
+	// pos is the byte offset of the next character to read
+	pos int
+}
+
+// next reads the next word, it reports whether it's a `NAME=value` assignment, and false if there's no word left.
+func (p *lineParser) next() (word string, isAssign bool, ok bool, err error) {
+	var (
+		buf strings.Builder
+
+		// started reports whether a word started, a quoted empty string is a word
+		started bool
+
+		// isName reports whether the characters read so far are the unquoted characters of a variable name
+		isName = true
+	)
+
+	for p.pos < len(p.line) {
+		r, size := utf8.DecodeRuneInString(p.line[p.pos:])
+
+		switch {
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if started {
+				return buf.String(), isAssign, true, nil
+			}
+
+			p.pos += size
+
+		case r == '#' && !started:
+			if end := strings.IndexByte(p.line[p.pos:], '\n'); end >= 0 {
+				p.pos += end
+			} else {
+				p.pos = len(p.line)
+			}
+
+		case r == '\\' && backslashEscapes:
+			p.pos += size
+
+			if p.pos >= len(p.line) {
+				buf.WriteRune('\\')
+				started, isName = true, false
+
+				break
+			}
+
+			escaped, size := utf8.DecodeRuneInString(p.line[p.pos:])
+			p.pos += size
+
+			// a line continuation is removed, it doesn't start a word
+			if escaped != '\n' {
+				buf.WriteRune(escaped)
+				started, isName = true, false
+			}
+
+		case r == '\'':
+			end := strings.IndexByte(p.line[p.pos+1:], '\'')
+
+			if end < 0 {
+				return "", false, false, errors.New("unterminated single quote")
+			}
+
+			buf.WriteString(p.line[p.pos+1 : p.pos+1+end])
+			p.pos += end + 2
+			started, isName = true, false
+
+		case r == '"':
+			p.pos += size
+			started, isName = true, false
+
+			if err := p.readDoubleQuoted(&buf); err != nil {
+				return "", false, false, err
+			}
+
+		case r == '$':
+			started, isName = true, false
+
+			if err := p.readExpansion(&buf); err != nil {
+				return "", false, false, err
+			}
+
+		case strings.ContainsRune("|&;<>()`", r):
+			return "", false, false, fmt.Errorf("%w: unquoted %q", ErrShellSyntax, r)
+
+		default:
+			p.pos += size
+			started = true
+
+			switch {
+			case r == '=' && isName && buf.Len() > 0 && !isAssign:
+				isAssign = true
+
+			case !isAssign && isName && !isNameRune(r, buf.Len() == 0):
+				isName = false
+			}
+
+			buf.WriteRune(r)
+		}
+	}
+
+	return buf.String(), isAssign, started, nil
+}
+
+// readDoubleQuoted reads the characters up to the closing double quote into buf.
+func (p *lineParser) readDoubleQuoted(buf *strings.Builder) error {
+	for p.pos < len(p.line) {
+		r, size := utf8.DecodeRuneInString(p.line[p.pos:])
+
+		switch r {
+		case '"':
+			p.pos += size
+			return nil
+
+		case '$':
+			if err := p.readExpansion(buf); err != nil {
+				return err
+			}
+
+		case '`':
+			return fmt.Errorf("%w: command substitution", ErrShellSyntax)
+
+		case '\\':
+			p.pos += size
+
+			if backslashEscapes && p.pos < len(p.line) && strings.ContainsRune("$`\"\\\n", rune(p.line[p.pos])) {
+				if p.line[p.pos] != '\n' {
+					buf.WriteByte(p.line[p.pos])
+				}
+
+				p.pos++
+			} else {
+				buf.WriteRune('\\')
+			}
+
+		default:
+			buf.WriteRune(r)
+			p.pos += size
+		}
+	}
+
+	return errors.New("unterminated double quote")
+}
+
+// readExpansion reads the `$NAME` or `${NAME}` expansion at the current position, writing the variable value into buf.
+// a `$` not followed by a name is kept as is.
+func (p *lineParser) readExpansion(buf *strings.Builder) error {
+	rest := p.line[p.pos+1:]
+
+	switch {
+	case strings.HasPrefix(rest, "("):
+		return fmt.Errorf("%w: command substitution", ErrShellSyntax)
+
+	case strings.HasPrefix(rest, "{"):
+		end := strings.IndexByte(rest, '}')
+
+		if end < 0 {
+			return errors.New("unterminated variable expansion")
+		}
+
+		name := rest[1:end]
+
+		if !isName(name) {
+			return fmt.Errorf("%w: unsupported expansion ${%s}", ErrShellSyntax, name)
+		}
+
+		buf.WriteString(os.Getenv(name))
+		p.pos += end + 2
+
+	default:
+		end := 0
+
+		for end < len(rest) && isNameRune(rune(rest[end]), end == 0) {
+			end++
+		}
+
+		if end == 0 {
+			buf.WriteByte('$')
+			p.pos++
+
+			return nil
+		}
+
+		buf.WriteString(os.Getenv(rest[:end]))
+		p.pos += end + 1
+	}
+
+	return nil
+}
+
+// isName reports whether s is a valid variable name.
+func isName(s string) bool {
+	for i, r := range s {
+		if !isNameRune(r, i == 0) {
+			return false
+		}
+	}
+
+	return s != ""
+}
+
+// isNameRune reports whether r is valid in a variable name, digits can't start it.
+func isNameRune(r rune, first bool) bool {
+	return r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || !first && r >= '0' && r <= '9'
+}
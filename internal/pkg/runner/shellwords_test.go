@@ -0,0 +1,132 @@
+//go:build !windows
+
+package runner_test
+
+import (
+	"errors"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/huboh/gwatch/internal/pkg/runner"
+)
+
+func TestParseCommandLine(t *testing.T) {
+	type TestData struct {
+		line string
+		env  []string
+		args []string
+		err  error
+	}
+
+	t.Setenv("GWATCH_VERSION", "dev")
+
+	testData := []TestData{
+		{
+			line: "go  build   -o ./bin/app .",
+			args: []string{"go", "build", "-o", "./bin/app", "."},
+		},
+		{
+			line: `go build -ldflags "-X main.version=dev" .`,
+			args: []string{"go", "build", "-ldflags", "-X main.version=dev", "."},
+		},
+		{
+			line: `go build -ldflags '-X "main.version=$GWATCH_VERSION"' .`,
+			args: []string{"go", "build", "-ldflags", `-X "main.version=$GWATCH_VERSION"`, "."},
+		},
+		{
+			line: `go build -ldflags "-X main.version=$GWATCH_VERSION -X main.commit=${GWATCH_COMMIT}" .`,
+			args: []string{"go", "build", "-ldflags", "-X main.version=dev -X main.commit=", "."},
+		},
+		{
+			line: `CGO_ENABLED=0 GOFLAGS="-mod=vendor -trimpath" go build .`,
+			env:  []string{"CGO_ENABLED=0", "GOFLAGS=-mod=vendor -trimpath"},
+			args: []string{"go", "build", "."},
+		},
+		{
+			line: `go run . --name=app "" \"quoted\" my\ dir`,
+			args: []string{"go", "run", ".", "--name=app", "", `"quoted"`, "my dir"},
+		},
+		{
+			line: "go build \\\n  -o ./bin/app . # build the app",
+			args: []string{"go", "build", "-o", "./bin/app", "."},
+		},
+		{
+			line: "go test ./... | tee test.log",
+			err:  runner.ErrShellSyntax,
+		},
+		{
+			line: "go generate ./... && go build .",
+			err:  runner.ErrShellSyntax,
+		},
+		{
+			line: "go build -ldflags \"-X main.commit=$(git rev-parse HEAD)\" .",
+			err:  runner.ErrShellSyntax,
+		},
+		{
+			line: "go build > build.log",
+			err:  runner.ErrShellSyntax,
+		},
+	}
+
+	for _, td := range testData {
+		cmdLine, err := runner.ParseCommandLine(td.line)
+
+		if td.err != nil {
+			if !errors.Is(err, td.err) {
+				t.Errorf("%s: expected error %v got %v\n", td.line, td.err, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %s\n", td.line, err)
+			continue
+		}
+
+		if !slices.Equal(cmdLine.Env, td.env) || !slices.Equal(cmdLine.Args, td.args) {
+			t.Errorf("%s: expected %q %q got %q %q\n", td.line, td.env, td.args, cmdLine.Env, cmdLine.Args)
+		}
+	}
+}
+
+func TestJoinCommandLine(t *testing.T) {
+	testData := []struct {
+		args []string
+		line string
+	}{
+		{
+			args: []string{"go", "build", "-o", "./bin/app", "."},
+			line: "go build -o ./bin/app .",
+		},
+		{
+			args: []string{"./bin/app", "--name", "my app", ""},
+			line: "./bin/app --name 'my app' ''",
+		},
+		{
+			args: []string{"echo", "it's", "$HOME", "a;b", "*.go", "x|y"},
+			line: `echo 'it'\''s' '$HOME' 'a;b' '*.go' 'x|y'`,
+		},
+	}
+
+	for _, td := range testData {
+		line := runner.JoinCommandLine(td.args)
+
+		if line != td.line {
+			t.Errorf("%q: expected %s got %s\n", td.args, td.line, line)
+		}
+
+		// the shell passes the arguments as they are, printf writes them one per line
+		out, err := exec.Command("sh", "-c", "printf '%s\\n' "+line).Output()
+
+		if err != nil {
+			t.Fatalf("%s: %s\n", line, err)
+		}
+
+		if words := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n"); !slices.Equal(words, td.args) {
+			t.Errorf("%s: expected the shell words %q got %q\n", line, td.args, words)
+		}
+	}
+}
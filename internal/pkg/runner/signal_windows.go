@@ -0,0 +1,19 @@
+//go:build windows
+
+package runner
+
+import (
+	"os"
+)
+
+var (
+	// signals maps the names of the stop signals to their signal.
+	// windows can't send the other signals, so the processes are killed right away
+	signals = map[string]os.Signal{
+		"SIGTERM": os.Kill,
+		"SIGINT":  os.Kill,
+		"SIGHUP":  os.Kill,
+		"SIGQUIT": os.Kill,
+		"SIGKILL": os.Kill,
+	}
+)
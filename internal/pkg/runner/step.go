@@ -0,0 +1,130 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/huboh/gwatch/internal/pkg/config"
+)
+
+const (
+	// FailureAbort skips the next steps of the pipeline, and the start of the application, when a step fails.
+	FailureAbort = "abort"
+
+	// FailureContinue runs the next steps when a step fails, the failure is only logged.
+	FailureContinue = "continue"
+
+	// FailureWarn runs the next steps when a step fails, the failure is reported as a warning.
+	FailureWarn = "warn"
+)
+
+const (
+	// StageBeforeBuild is the stage of the steps run before the build
+	StageBeforeBuild = "before_build"
+
+	// StageBuild is the stage of the build steps
+	StageBuild = "build"
+
+	// StageAfterBuild is the stage of the steps run once the build succeeded
+	StageAfterBuild = "after_build"
+
+	// StageBeforeRun is the stage of the steps run before each start of the application
+	StageBeforeRun = "before_run"
+
+	// StageAfterStop is the stage of the steps run once the application was stopped
+	StageAfterStop = "after_stop"
+)
+
+// step is a command of the pipeline, along with it's failure policy.
+type step struct {
+	// stage is the stage of the pipeline the step belongs to
+	stage string
+
+	// name is the name the step is reported with
+	name string
+
+	// cmd is the command of the step
+	cmd *Command
+
+	// onFailure is the failure policy, one of FailureAbort, FailureContinue or FailureWarn
+	onFailure string
+}
+
+// newSteps creates the steps of the pipeline stage, the steps are killed right away when they're stopped.
+func newSteps(stage string, steps []config.Step, outPrefix string) ([]*step, error) {
+	var s []*step
+
+	for i, cfg := range steps {
+		cmdLine, err := commandLine(cfg.Cmd, cfg.Shell)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s step %d: %w", stage, i+1, err)
+		}
+
+		onFailure := cfg.OnFailure
+
+		switch onFailure {
+		case FailureAbort, FailureContinue, FailureWarn:
+
+		case "":
+			onFailure = FailureAbort
+
+		default:
+			return nil, fmt.Errorf("invalid %s step %d: unknown failure policy %q", stage, i+1, onFailure)
+		}
+
+		name := cfg.Name
+
+		if name == "" {
+			name = cfg.Cmd.String()
+		}
+
+		s = append(s, &step{
+			stage:     stage,
+			name:      name,
+			cmd:       NewCommand(cmdLine, outPrefix, StopOptions{Signal: os.Kill}),
+			onFailure: onFailure,
+		})
+	}
+
+	return s, nil
+}
+
+// StepReport is how a step of the pipeline ran.
+type StepReport struct {
+	// Stage is the stage of the pipeline the step belongs to, like StageBeforeBuild
+	Stage string
+
+	// Name is the name of the step, it's command by default
+	Name string
+
+	// Duration is how long the step took
+	Duration time.Duration
+
+	// Err is the reason the step failed, it's nil if it succeeded
+	Err error
+
+	// OnFailure is the failure policy of the step
+	OnFailure string
+}
+
+func (r StepReport) String() string {
+	took := r.Duration.Round(time.Millisecond)
+
+	if r.Err == nil {
+		return fmt.Sprintf("%s: %s done in %s", r.Stage, r.Name, took)
+	}
+
+	next := "continuing"
+
+	switch r.OnFailure {
+	case FailureAbort:
+		next = "aborting"
+
+	case FailureWarn:
+		next = "continuing with a warning"
+	}
+
+	return fmt.Sprintf("%s: %s failed in %s: %s, %s", r.Stage, r.Name, took, r.Err, next)
+}
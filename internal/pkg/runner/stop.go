@@ -0,0 +1,98 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// groupKillTimeout is how long the killed processes of a process group are waited for.
+const groupKillTimeout = time.Second * 2
+
+// StopOptions is how the process of a command is stopped when it's run again or the runner is stopped.
+type StopOptions struct {
+	// Signal is the signal sent to the process, it's killed right away if it's os.Kill
+	Signal os.Signal
+
+	// Timeout is how long the process is given to exit after the Signal, before it's killed
+	Timeout time.Duration
+}
+
+// StopReport is how the process of a command exited once it was stopped.
+type StopReport struct {
+	// Process is the name of the stopped process, it's empty for the application of the run config
+	Process string
+
+	// Signal is the stop signal sent to the process
+	Signal os.Signal
+
+	// Killed reports whether the process was killed, after the Timeout, because it could not be sent the Signal or by Kill
+	Killed bool
+
+	// Interrupted reports whether the stop was cut short by Kill, before the Timeout
+	Interrupted bool
+
+	// Duration is how long the process took to exit
+	Duration time.Duration
+
+	// Timeout is the stop timeout the process was given
+	Timeout time.Duration
+}
+
+func (r StopReport) String() string {
+	switch {
+	case !r.Killed:
+		return fmt.Sprintf("exited on %s in %s", signalName(r.Signal), r.Duration.Round(time.Millisecond))
+
+	case r.Signal == os.Kill:
+		return "killed"
+
+	case r.Interrupted:
+		return fmt.Sprintf("killed %s after %s, the stop was interrupted", r.Duration.Round(time.Millisecond), signalName(r.Signal))
+
+	case r.Duration >= r.Timeout:
+		return fmt.Sprintf("killed, it did not exit within %s of %s", r.Timeout, signalName(r.Signal))
+
+	default:
+		return fmt.Sprintf("killed, it could not be sent %s", signalName(r.Signal))
+	}
+}
+
+// ParseSignal returns the stop signal named name, like `SIGTERM` or `TERM`, case insensitively.
+func ParseSignal(name string) (os.Signal, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+
+	if sig, ok := signals[name]; ok {
+		return sig, nil
+	}
+
+	return nil, fmt.Errorf("unknown stop signal %q", name)
+}
+
+// signalName returns the name of the signal, like `SIGTERM`.
+func signalName(sig os.Signal) string {
+	for name, s := range signals {
+		if s == sig && (sig != os.Kill || name == "SIGKILL") {
+			return name
+		}
+	}
+
+	return sig.String()
+}
+
+// waitGroup waits for the processes of the process group led by the process pid to exit, for up to the timeout.
+// it reports whether they did.
+func waitGroup(pid int, timeout time.Duration) bool {
+	for deadline := time.Now().Add(timeout); groupAlive(pid); time.Sleep(time.Millisecond * 10) {
+		if time.Now().After(deadline) {
+			return false
+		}
+	}
+
+	return true
+}
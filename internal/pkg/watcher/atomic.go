@@ -0,0 +1,119 @@
+package watcher
+
+import (
+	"sync"
+	"time"
+)
+
+// atomicSaveWindow is how long the removal of a watched file is held, waiting for the file to be created again.
+const atomicSaveWindow = time.Millisecond * 50
+
+// heldEvent is a held removal event, along with the timer releasing it.
+type heldEvent struct {
+	event Event
+	timer *time.Timer
+}
+
+// atomicSaves recognizes the atomic saves of editors, where the file is renamed or removed then created again at the
+// same path, like vim's backups or jetbrains' safe-writes. the removal is held for a short window, and if the file is
+// created again as a file in it, both events are replaced by a single write event.
+type atomicSaves struct {
+	// pending is the held removals & their timer, keyed by path
+	pending map[string]heldEvent
+
+	// pendingMemAccess prevent concurrent access to pending
+	pendingMemAccess *sync.Mutex
+
+	// expired is the channel the removals that were not followed by a create are sent to
+	expired chan Event
+
+	// done is closed once the removals are no longer received from expired
+	done chan struct{}
+}
+
+func newAtomicSaves() *atomicSaves {
+	return &atomicSaves{
+		pending:          make(map[string]heldEvent),
+		pendingMemAccess: new(sync.Mutex),
+		expired:          make(chan Event),
+		done:             make(chan struct{}),
+	}
+}
+
+// Hold holds the removal event, it's sent to the Expired channel if the path is not created again within the window.
+func (a *atomicSaves) Hold(e Event) {
+	a.pendingMemAccess.Lock()
+	defer a.pendingMemAccess.Unlock()
+
+	if held, ok := a.pending[e.Path]; ok {
+		held.timer.Stop()
+	}
+
+	var timer *time.Timer
+
+	timer = time.AfterFunc(atomicSaveWindow, func() {
+		a.pendingMemAccess.Lock()
+		held, ok := a.pending[e.Path]
+		ok = ok && held.timer == timer
+
+		if ok {
+			delete(a.pending, e.Path)
+		}
+
+		a.pendingMemAccess.Unlock()
+
+		// the path was created again, or removed again, in the meantime
+		if !ok {
+			return
+		}
+
+		select {
+		case a.expired <- e:
+		case <-a.done:
+		}
+	})
+
+	a.pending[e.Path] = heldEvent{event: e, timer: timer}
+}
+
+// Release returns the held removal of the created path, dropping it. It reports false if none is held.
+func (a *atomicSaves) Release(e Event) (Event, bool) {
+	a.pendingMemAccess.Lock()
+	defer a.pendingMemAccess.Unlock()
+
+	held, ok := a.pending[e.Path]
+
+	if ok {
+		held.timer.Stop()
+		delete(a.pending, e.Path)
+	}
+
+	return held.event, ok
+}
+
+// Expired returns the channel the held removals are sent to once their window is over.
+func (a *atomicSaves) Expired() <-chan Event {
+	return a.expired
+}
+
+// Stop drops the held removals.
+func (a *atomicSaves) Stop() {
+	a.pendingMemAccess.Lock()
+	defer a.pendingMemAccess.Unlock()
+
+	for path, held := range a.pending {
+		held.timer.Stop()
+		delete(a.pending, path)
+	}
+
+	close(a.done)
+}
+
+// isAtomicSaveRemoval reports whether the event may be the first half of an atomic save: the removal of a watched file.
+func (w *Watcher) isAtomicSaveRemoval(e Event) bool {
+	if !e.Type.Has(RemoveEvent) && !e.Type.Has(RenameEvent) || e.Type.Has(CreateEvent) {
+		return false
+	}
+
+	return !w.isWatchedDir(e.Path) && w.configs.IsWatched(e.Path)
+}
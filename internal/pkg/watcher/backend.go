@@ -0,0 +1,101 @@
+package watcher
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// BackendFsnotify receives events from the os (inotify, kqueue, ReadDirectoryChangesW...) using fsnotify.
+	BackendFsnotify = "fsnotify"
+
+	// BackendPoll periodically scans the watched paths for changes to their entries mtime & size.
+	// it works on filesystems where the os does not deliver events, like bind-mounted volumes & network filesystems.
+	BackendPoll = "poll"
+
+	// BackendAuto uses fsnotify, and falls back to polling for paths fsnotify fails to watch.
+	BackendAuto = "auto"
+)
+
+var (
+	// ErrNotWatched is returned when removing a path that is not in the watch list.
+	ErrNotWatched = errors.New("path is not watched")
+)
+
+// WatchLimitError is returned when watching a path exceeds the os limit of watches, like inotify's `max_user_watches`.
+type WatchLimitError struct {
+	// Needed is the number of directories to watch, zero if unknown
+	Needed int
+
+	// Watched is the number of directories watched before the limit was reached
+	Watched int
+
+	// Limit is the os limit of watches, zero if unknown
+	Limit int
+
+	// Err is the underlying os error
+	Err error
+}
+
+func (e *WatchLimitError) Error() string {
+	msg := fmt.Sprintf("os limit of watches reached after watching %d directories", e.Watched)
+
+	if e.Needed > 0 {
+		msg += fmt.Sprintf(" out of %d", e.Needed)
+	}
+
+	if e.Limit > 0 {
+		msg += fmt.Sprintf(", the limit is %d watches shared by all your processes", e.Limit)
+	}
+
+	return fmt.Sprintf("%s, %s: %s", msg, watchLimitHint(), e.Err)
+}
+
+func (e *WatchLimitError) Unwrap() error {
+	return e.Err
+}
+
+// Backend is the source of the filesystem events of the watched paths.
+//
+// Like inotify, watching a directory delivers the events of it's direct entries, not of it's subdirectories content.
+type Backend interface {
+	// Add adds the path to the watch list.
+	Add(path string) error
+
+	// Remove removes the path from the watch list, it returns ErrNotWatched if the path is not watched.
+	Remove(path string) error
+
+	// WatchList returns the watched paths.
+	WatchList() []string
+
+	// Events returns the channel the events are delivered on, it's closed when the backend is closed.
+	Events() <-chan Event
+
+	// Errors returns the channel the errors are delivered on, it's closed when the backend is closed.
+	Errors() <-chan error
+
+	// Close stops watching all paths.
+	Close() error
+}
+
+// newBackend creates the backend of the watchers, it's replaced in the tests.
+var newBackend = NewBackend
+
+// NewBackend creates the backend of the given kind.
+//
+// pollInterval is the interval in between scans of the polling backend.
+func NewBackend(kind string, pollInterval time.Duration) (Backend, error) {
+	switch kind {
+	case BackendFsnotify:
+		return newFsnotifyBackend()
+
+	case BackendPoll:
+		return newPollBackend(pollInterval), nil
+
+	case BackendAuto, "":
+		return newAutoBackend(pollInterval)
+	}
+
+	return nil, fmt.Errorf("unknown watcher backend %q, expected one of %s, %s or %s", kind, BackendFsnotify, BackendPoll, BackendAuto)
+}
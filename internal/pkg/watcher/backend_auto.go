@@ -0,0 +1,158 @@
+package watcher
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// autoBackend is the Backend watching paths with fsnotify, and falling back to polling
+// for the paths fsnotify fails to watch, like when the inotify `max_user_watches` limit is reached.
+//
+// once the limit is reached, the paths added after are polled without trying fsnotify first.
+type autoBackend struct {
+	// fsnotify is the preferred backend
+	fsnotify Backend
+
+	// poll is the fallback backend
+	poll *pollBackend
+
+	// events is the channel the events of both backends are merged into
+	events chan Event
+
+	// errors is the channel the errors of both backends are merged into
+	errors chan error
+
+	// done is closed when the backend is closed
+	done chan struct{}
+
+	// closeOnce ensures done is closed once
+	closeOnce *sync.Once
+
+	// limitErr is the error of the first path fsnotify failed to watch because of the os limit, nil if it's not reached
+	limitErr *WatchLimitError
+
+	// limitMemAccess prevent concurrent access to limitErr
+	limitMemAccess *sync.Mutex
+}
+
+func newAutoBackend(pollInterval time.Duration) (*autoBackend, error) {
+	fsnotify, err := newFsnotifyBackend()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newAutoBackendOver(fsnotify, pollInterval), nil
+}
+
+// newAutoBackendOver creates the auto backend watching the paths with the preferred backend, until it reaches the limit of watches.
+func newAutoBackendOver(preferred Backend, pollInterval time.Duration) *autoBackend {
+	b := &autoBackend{
+		fsnotify:       preferred,
+		poll:           newPollBackend(pollInterval),
+		events:         make(chan Event),
+		errors:         make(chan error),
+		done:           make(chan struct{}),
+		closeOnce:      new(sync.Once),
+		limitMemAccess: new(sync.Mutex),
+	}
+
+	go b.merge()
+
+	return b
+}
+
+// merge forwards the events & errors of both backends until they're both closed.
+func (b *autoBackend) merge() {
+	var wg sync.WaitGroup
+
+	for _, backend := range []Backend{b.fsnotify, b.poll} {
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+
+			for e := range backend.Events() {
+				select {
+				case b.events <- e:
+				case <-b.done:
+				}
+			}
+		}()
+
+		go func() {
+			defer wg.Done()
+
+			for err := range backend.Errors() {
+				select {
+				case b.errors <- err:
+				case <-b.done:
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(b.events)
+	close(b.errors)
+}
+
+func (b *autoBackend) Add(path string) error {
+	b.limitMemAccess.Lock()
+	defer b.limitMemAccess.Unlock()
+
+	if b.limitErr != nil {
+		return b.poll.Add(path)
+	}
+
+	err := b.fsnotify.Add(path)
+
+	if err == nil || os.IsNotExist(err) {
+		return err
+	}
+
+	var limitErr *WatchLimitError
+
+	if errors.As(err, &limitErr) {
+		b.limitErr = limitErr
+	}
+
+	return b.poll.Add(path)
+}
+
+// LimitErr returns the error of the first path fsnotify failed to watch because of the os limit,
+// or nil if the limit was not reached.
+func (b *autoBackend) LimitErr() *WatchLimitError {
+	b.limitMemAccess.Lock()
+	defer b.limitMemAccess.Unlock()
+
+	return b.limitErr
+}
+
+func (b *autoBackend) Remove(path string) error {
+	if err := b.fsnotify.Remove(path); !errors.Is(err, ErrNotWatched) {
+		return err
+	}
+
+	return b.poll.Remove(path)
+}
+
+func (b *autoBackend) WatchList() []string {
+	return append(b.fsnotify.WatchList(), b.poll.WatchList()...)
+}
+
+func (b *autoBackend) Events() <-chan Event {
+	return b.events
+}
+
+func (b *autoBackend) Errors() <-chan error {
+	return b.errors
+}
+
+func (b *autoBackend) Close() error {
+	b.closeOnce.Do(func() { close(b.done) })
+
+	return errors.Join(b.fsnotify.Close(), b.poll.Close())
+}
@@ -0,0 +1,122 @@
+package watcher
+
+import (
+	"errors"
+	"sync"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// fsnotifyBackend is the Backend receiving events from the os using fsnotify.
+type fsnotifyBackend struct {
+	// watcher is the underlying fsnotify watcher
+	watcher *fsnotify.Watcher
+
+	// events is the channel the converted fsnotify events are forwarded to
+	events chan Event
+
+	// errors is the channel the fsnotify errors are forwarded to
+	errors chan error
+
+	// done is closed when the backend is closed
+	done chan struct{}
+
+	// closeOnce ensures done is closed once
+	closeOnce *sync.Once
+}
+
+func newFsnotifyBackend() (*fsnotifyBackend, error) {
+	watcher, err := fsnotify.NewWatcher()
+
+	if err != nil {
+		return nil, err
+	}
+
+	b := &fsnotifyBackend{
+		watcher:   watcher,
+		events:    make(chan Event),
+		errors:    make(chan error),
+		done:      make(chan struct{}),
+		closeOnce: new(sync.Once),
+	}
+
+	go b.forward()
+
+	return b, nil
+}
+
+// forward converts and forwards the fsnotify events & errors until the fsnotify watcher is closed.
+func (b *fsnotifyBackend) forward() {
+	defer close(b.events)
+	defer close(b.errors)
+
+	for {
+		select {
+		case evt, open := <-b.watcher.Events:
+			if !open {
+				return
+			}
+
+			select {
+			case b.events <- *NewEvent(EventType(evt.Op), evt.Name):
+			case <-b.done:
+				return
+			}
+
+		case err, open := <-b.watcher.Errors:
+			if !open {
+				return
+			}
+
+			select {
+			case b.errors <- err:
+			case <-b.done:
+				return
+			}
+		}
+	}
+}
+
+func (b *fsnotifyBackend) Add(path string) error {
+	if err := b.watcher.Add(path); err != nil {
+		if isWatchLimitErr(err) {
+			return &WatchLimitError{Watched: len(b.watcher.WatchList()), Limit: watchLimit(), Err: err}
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (b *fsnotifyBackend) Remove(path string) error {
+	if err := b.watcher.Remove(path); err != nil {
+		// the kernel already removed the watch of a deleted directory, before it's event was received
+		if errors.Is(err, fsnotify.ErrNonExistentWatch) || errors.Is(err, syscall.EINVAL) || errors.Is(err, syscall.ENOENT) {
+			return ErrNotWatched
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (b *fsnotifyBackend) WatchList() []string {
+	return b.watcher.WatchList()
+}
+
+func (b *fsnotifyBackend) Events() <-chan Event {
+	return b.events
+}
+
+func (b *fsnotifyBackend) Errors() <-chan error {
+	return b.errors
+}
+
+func (b *fsnotifyBackend) Close() error {
+	b.closeOnce.Do(func() { close(b.done) })
+
+	return b.watcher.Close()
+}
@@ -0,0 +1,272 @@
+package watcher
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// fileState is the state of a file the polling backend compares in between scans.
+type fileState struct {
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+// snapshot is the state of a watched path entries, keyed by the entries path.
+// the snapshot of a watched file only holds the file itself.
+type snapshot map[string]fileState
+
+// pollBackend is the Backend periodically scanning the watched paths for changes.
+type pollBackend struct {
+	// interval is the interval in between scans
+	interval time.Duration
+
+	// watches is the last snapshot of each watched path
+	watches map[string]snapshot
+
+	// watchesMemAccess prevent concurrent access to the watches
+	watchesMemAccess *sync.Mutex
+
+	// events is the channel the detected changes are delivered on
+	events chan Event
+
+	// errors is the channel the scan errors are delivered on
+	errors chan error
+
+	// done is closed when the backend is closed
+	done chan struct{}
+
+	// closeOnce ensures done is closed once
+	closeOnce *sync.Once
+}
+
+func newPollBackend(interval time.Duration) *pollBackend {
+	if interval <= 0 {
+		interval = time.Millisecond * 500
+	}
+
+	b := &pollBackend{
+		interval:         interval,
+		watches:          make(map[string]snapshot),
+		watchesMemAccess: new(sync.Mutex),
+		events:           make(chan Event),
+		errors:           make(chan error),
+		done:             make(chan struct{}),
+		closeOnce:        new(sync.Once),
+	}
+
+	go b.poll()
+
+	return b
+}
+
+// poll scans the watched paths every interval until the backend is closed.
+func (b *pollBackend) poll() {
+	defer close(b.events)
+	defer close(b.errors)
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.done:
+			return
+
+		case <-ticker.C:
+			events, errs := b.scan()
+
+			for _, err := range errs {
+				select {
+				case b.errors <- err:
+				case <-b.done:
+					return
+				}
+			}
+
+			for _, e := range events {
+				select {
+				case b.events <- e:
+				case <-b.done:
+					return
+				}
+			}
+		}
+	}
+}
+
+// scan takes a new snapshot of each watched path and returns the changes since the last one.
+func (b *pollBackend) scan() ([]Event, []error) {
+	b.watchesMemAccess.Lock()
+	defer b.watchesMemAccess.Unlock()
+
+	var (
+		events []Event
+		errs   []error
+	)
+
+	for path, prev := range b.watches {
+		next, err := takeSnapshot(path)
+
+		if err != nil {
+			if !os.IsNotExist(err) {
+				errs = append(errs, err)
+				continue
+			}
+
+			// like inotify, the watch of a removed path is dropped.
+			// the removal of a directory itself is reported by the scan of it's parent directory.
+			next = snapshot{}
+			delete(b.watches, path)
+		} else {
+			b.watches[path] = next
+		}
+
+		events = append(events, diffSnapshots(prev, next)...)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Path < events[j].Path
+	})
+
+	return events, errs
+}
+
+func (b *pollBackend) Add(path string) error {
+	snap, err := takeSnapshot(path)
+
+	if err != nil {
+		return err
+	}
+
+	b.watchesMemAccess.Lock()
+	defer b.watchesMemAccess.Unlock()
+
+	b.watches[filepath.Clean(path)] = snap
+
+	return nil
+}
+
+func (b *pollBackend) Remove(path string) error {
+	b.watchesMemAccess.Lock()
+	defer b.watchesMemAccess.Unlock()
+
+	path = filepath.Clean(path)
+
+	if _, ok := b.watches[path]; !ok {
+		return ErrNotWatched
+	}
+
+	delete(b.watches, path)
+
+	return nil
+}
+
+func (b *pollBackend) WatchList() []string {
+	b.watchesMemAccess.Lock()
+	defer b.watchesMemAccess.Unlock()
+
+	paths := make([]string, 0, len(b.watches))
+
+	for p := range b.watches {
+		paths = append(paths, p)
+	}
+
+	return paths
+}
+
+func (b *pollBackend) Events() <-chan Event {
+	return b.events
+}
+
+func (b *pollBackend) Errors() <-chan error {
+	return b.errors
+}
+
+func (b *pollBackend) Close() error {
+	b.closeOnce.Do(func() { close(b.done) })
+
+	return nil
+}
+
+// takeSnapshot returns the state of the entries of the directory at path, or of the file itself.
+func takeSnapshot(path string) (snapshot, error) {
+	path = filepath.Clean(path)
+	stat, err := os.Stat(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !stat.IsDir() {
+		return snapshot{path: newFileState(stat)}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	snap := make(snapshot, len(entries))
+
+	for _, e := range entries {
+		info, err := e.Info()
+
+		// the entry was removed in between reading the directory and it's info
+		if err != nil {
+			continue
+		}
+
+		snap[filepath.Join(path, e.Name())] = newFileState(info)
+	}
+
+	return snap, nil
+}
+
+func newFileState(info fs.FileInfo) fileState {
+	return fileState{
+		size:    info.Size(),
+		mode:    info.Mode(),
+		modTime: info.ModTime(),
+	}
+}
+
+// diffSnapshots returns the events turning the prev snapshot into next.
+func diffSnapshots(prev, next snapshot) []Event {
+	var events []Event
+
+	for path, state := range next {
+		prevState, existed := prev[path]
+
+		switch {
+		case !existed:
+			events = append(events, *NewEvent(CreateEvent, path))
+
+		// a file replaced by a directory or the other way round
+		case prevState.mode.Type() != state.mode.Type():
+			events = append(events, *NewEvent(RemoveEvent, path), *NewEvent(CreateEvent, path))
+
+		case prevState.size != state.size || !prevState.modTime.Equal(state.modTime):
+			// directories mtime changes when their entries are changed, which is reported by their own watch
+			if !state.mode.IsDir() {
+				events = append(events, *NewEvent(WriteEvent, path))
+			}
+
+		case prevState.mode != state.mode:
+			events = append(events, *NewEvent(ChmodEvent, path))
+		}
+	}
+
+	for path := range prev {
+		if _, exists := next[path]; !exists {
+			events = append(events, *NewEvent(RemoveEvent, path))
+		}
+	}
+
+	return events
+}
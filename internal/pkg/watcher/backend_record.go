@@ -0,0 +1,138 @@
+package watcher
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// recordBackend is the Backend recording the raw events of another backend to a session file, see replayBackend.
+type recordBackend struct {
+	Backend
+
+	// root is the directory the recorded paths are relative to
+	root string
+
+	// file is the session file
+	file *os.File
+
+	// start is when the recording started
+	start time.Time
+
+	// events is the channel the recorded events are forwarded to
+	events chan Event
+
+	// errors is the channel the errors of the recorded backend & the recording are forwarded to
+	errors chan error
+
+	// done is closed when the backend is closed
+	done chan struct{}
+
+	// closeOnce ensures done is closed once
+	closeOnce *sync.Once
+}
+
+// newRecordBackend records the events of the backend to the session file at path. the session is started over
+// if start is zero, it's appended to otherwise, so it's recorded whole with it's timing when the watcher is created again.
+func newRecordBackend(backend Backend, root, path string, start time.Time) (*recordBackend, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	file, start, err := openSession(path, start)
+
+	if err != nil {
+		return nil, err
+	}
+
+	b := &recordBackend{
+		Backend:   backend,
+		root:      root,
+		file:      file,
+		start:     start,
+		events:    make(chan Event),
+		errors:    make(chan error),
+		done:      make(chan struct{}),
+		closeOnce: new(sync.Once),
+	}
+
+	go b.record()
+
+	return b, nil
+}
+
+// openSession opens the session file along with when the session started: a new session truncates the file,
+// a started one is appended to.
+func openSession(path string, start time.Time) (*os.File, time.Time, error) {
+	if !start.IsZero() {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		return file, start, err
+	}
+
+	file, err := os.Create(path)
+
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	return file, time.Now(), nil
+}
+
+// record writes the events of the recorded backend to the session file, then forwards them.
+func (b *recordBackend) record() {
+	defer close(b.events)
+	defer close(b.errors)
+
+	encoder := json.NewEncoder(b.file)
+
+	for {
+		select {
+		case evt, open := <-b.Backend.Events():
+			if !open {
+				return
+			}
+
+			if err := encoder.Encode(newRecord(b.root, time.Since(b.start), evt)); err != nil {
+				b.forwardError(err)
+			}
+
+			select {
+			case b.events <- evt:
+			case <-b.done:
+				return
+			}
+
+		case err, open := <-b.Backend.Errors():
+			if !open {
+				return
+			}
+
+			b.forwardError(err)
+		}
+	}
+}
+
+// forwardError forwards the error, unless the backend is closed.
+func (b *recordBackend) forwardError(err error) {
+	select {
+	case b.errors <- err:
+	case <-b.done:
+	}
+}
+
+func (b *recordBackend) Events() <-chan Event {
+	return b.events
+}
+
+func (b *recordBackend) Errors() <-chan error {
+	return b.errors
+}
+
+func (b *recordBackend) Close() error {
+	b.closeOnce.Do(func() { close(b.done) })
+
+	return errors.Join(b.Backend.Close(), b.file.Close())
+}
@@ -0,0 +1,206 @@
+package watcher
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// replayBackend is the Backend replaying the events of a session recorded by recordBackend, with their recorded timing.
+//
+// it doesn't watch the disk: every recorded event is delivered whatever the watch list, and the state of the paths
+// is the one recorded along with their last delivered event, see Stat.
+type replayBackend struct {
+	// root is the directory the recorded paths are resolved against
+	root string
+
+	// records is the recorded session
+	records []record
+
+	// watches is the watch list, only kept for WatchList
+	watches []string
+
+	// states is the recorded state of the paths of the delivered events
+	states map[string]record
+
+	// memAccess prevent concurrent access to the watches & states
+	memAccess *sync.Mutex
+
+	// events is the channel the recorded events are delivered on
+	events chan Event
+
+	// errors is the channel errors are delivered on, none is for now
+	errors chan error
+
+	// done is closed when the backend is closed
+	done chan struct{}
+
+	// closeOnce ensures done is closed once
+	closeOnce *sync.Once
+}
+
+func newReplayBackend(root, path string) (*replayBackend, error) {
+	records, err := readSession(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	b := &replayBackend{
+		root:      root,
+		records:   records,
+		states:    make(map[string]record),
+		memAccess: new(sync.Mutex),
+		events:    make(chan Event),
+		errors:    make(chan error),
+		done:      make(chan struct{}),
+		closeOnce: new(sync.Once),
+	}
+
+	go b.replay()
+
+	return b, nil
+}
+
+// readSession reads the records of the session file.
+func readSession(path string) ([]record, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	var (
+		records []record
+		scanner = bufio.NewScanner(file)
+	)
+
+	for line := 1; scanner.Scan(); line++ {
+		var r record
+
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("error reading session %s, line %d: %w", path, line, err)
+		}
+
+		if _, err := parseEventType(r.Type); err != nil {
+			return nil, fmt.Errorf("error reading session %s, line %d: %w", path, line, err)
+		}
+
+		records = append(records, r)
+	}
+
+	return records, scanner.Err()
+}
+
+// replay delivers the recorded events at their recorded offset, the channels are only closed when the backend is.
+func (b *replayBackend) replay() {
+	defer close(b.events)
+	defer close(b.errors)
+
+	start := time.Now()
+
+	for _, r := range b.records {
+		e, _ := r.event(b.root)
+
+		select {
+		case <-time.After(time.Until(start.Add(r.Offset))):
+		case <-b.done:
+			return
+		}
+
+		b.memAccess.Lock()
+		b.states[e.Path] = r
+		b.memAccess.Unlock()
+
+		select {
+		case b.events <- e:
+		case <-b.done:
+			return
+		}
+	}
+
+	<-b.done
+}
+
+// Stat returns the recorded state of the path along with it's last delivered event, the disk is never read:
+// a path no event was delivered for is reported missing.
+func (b *replayBackend) Stat(path string) (fs.FileInfo, error) {
+	b.memAccess.Lock()
+	r, ok := b.states[filepath.Clean(path)]
+	b.memAccess.Unlock()
+
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: path, Err: fs.ErrNotExist}
+	}
+
+	return r.stat(path)
+}
+
+// ContainsFiles reports whether the session recorded an event for a file in the directory tree rooted at dir
+// matched by match, in place of walking the directory on disk.
+func (b *replayBackend) ContainsFiles(dir string, match func(path string) bool) bool {
+	return slices.ContainsFunc(b.records, func(r record) bool {
+		e, err := r.event(b.root)
+
+		return err == nil && r.Kind == recordFile && e.Path != filepath.Clean(dir) && isWithin(e.Path, dir) && match(e.Path)
+	})
+}
+
+func (b *replayBackend) Add(path string) error {
+	b.memAccess.Lock()
+	defer b.memAccess.Unlock()
+
+	if path = filepath.Clean(path); !slices.Contains(b.watches, path) {
+		b.watches = append(b.watches, path)
+	}
+
+	return nil
+}
+
+func (b *replayBackend) Remove(path string) error {
+	b.memAccess.Lock()
+	defer b.memAccess.Unlock()
+
+	i := slices.Index(b.watches, filepath.Clean(path))
+
+	if i < 0 {
+		return ErrNotWatched
+	}
+
+	b.watches = slices.Delete(b.watches, i, i+1)
+
+	return nil
+}
+
+func (b *replayBackend) WatchList() []string {
+	b.memAccess.Lock()
+	defer b.memAccess.Unlock()
+
+	return slices.Clone(b.watches)
+}
+
+func (b *replayBackend) Events() <-chan Event {
+	return b.events
+}
+
+func (b *replayBackend) Errors() <-chan error {
+	return b.errors
+}
+
+func (b *replayBackend) Close() error {
+	b.closeOnce.Do(func() { close(b.done) })
+
+	return nil
+}
@@ -0,0 +1,400 @@
+package watcher
+
+import (
+	"errors"
+	"fmt"
+	"go/build"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/huboh/gwatch/internal/pkg/gomod"
+)
+
+// depsFiles is the list of files whose changes refresh the dependency graph.
+var depsFiles = []string{"go.mod", "go.sum", "go.work", "go.work.sum"}
+
+// depsRefreshDelay is the quiet period after the last change needing a refresh of the dependency graph before it's refreshed.
+const depsRefreshDelay = time.Millisecond * 100
+
+// depsRefreshMaxWait is the maximum time a burst of changes can delay the refresh of the dependency graph.
+const depsRefreshMaxWait = time.Second
+
+// depsGraph is the dependency closure of the build target, used to only watch the directories the app is built from.
+type depsGraph struct {
+	// root is the directory `go list` is run in
+	root string
+
+	// target is the package pattern of the build target
+	target string
+
+	// dirs is the set of the local packages directories in the closure
+	dirs map[string]struct{}
+
+	// watchDirs is the set of directories to watch: the closure's directories, the directories of their embedded files,
+	// the local modules directories for their go.mod files, and the closest existing parents of the missing packages
+	watchDirs map[string]struct{}
+
+	// missing is the set of the expected directories of the local packages imported by the closure that don't exist
+	missing map[string]struct{}
+
+	// imports is the set of import paths in the closure, including the standard library
+	imports map[string]struct{}
+
+	// pkgImports is the imports of the local packages in the closure by directory, as of the last refresh
+	pkgImports map[string][]string
+
+	// memAccess prevent concurrent access to the graph
+	memAccess *sync.RWMutex
+}
+
+// depsUpdate is the result of a refresh of the dependency graph, sent to Run to update the watch list.
+type depsUpdate struct {
+	// seq is the number of refreshes requested when the refresh started, the events held until then are decided by it
+	seq int64
+
+	// added & removed are the directories added to & removed from the directories to watch
+	added, removed []string
+
+	// err is the refresh error, the previous graph is kept
+	err error
+}
+
+// depsHeldEvent is an event held until the dependency graph is refreshed.
+type depsHeldEvent struct {
+	evt Event
+	seq int64
+}
+
+func newDepsGraph(root, target string) (*depsGraph, error) {
+	d := &depsGraph{
+		root:      root,
+		target:    target,
+		memAccess: new(sync.RWMutex),
+	}
+
+	if _, _, err := d.refresh(); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// refresh lists the closure again, it returns the directories added to & removed from the directories to watch.
+func (d *depsGraph) refresh() (added []string, removed []string, e error) {
+	pkgs, err := gomod.Deps(d.root, d.target)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		dirs       = make(map[string]struct{})
+		watchDirs  = make(map[string]struct{})
+		missing    = make(map[string]struct{})
+		imports    = make(map[string]struct{}, len(pkgs))
+		pkgImports = make(map[string][]string)
+
+		// modules is the directories of the local modules by module path
+		modules = make(map[string]string)
+	)
+
+	for _, pkg := range pkgs {
+		imports[pkg.ImportPath] = struct{}{}
+
+		if !pkg.IsLocal() || pkg.Dir == "" {
+			continue
+		}
+
+		if pkg.Module.Dir != "" {
+			modules[pkg.Module.Path] = pkg.Module.Dir
+			watchDirs[pkg.Module.Dir] = struct{}{}
+		}
+
+		dirs[pkg.Dir] = struct{}{}
+		watchDirs[pkg.Dir] = struct{}{}
+
+		for _, file := range pkg.EmbedFiles {
+			watchDirs[filepath.Dir(filepath.Join(pkg.Dir, filepath.FromSlash(file)))] = struct{}{}
+		}
+
+		// a package being edited is compared against the imports of the closure until the next refresh
+		if pkgImps, err := dirImports(pkg.Dir); err == nil {
+			pkgImports[pkg.Dir] = pkgImps
+		}
+	}
+
+	// the packages that don't exist yet are reported without a directory, their parent is watched for their creation
+	for _, pkg := range pkgs {
+		if pkg.Dir != "" || pkg.Standard {
+			continue
+		}
+
+		if dir, modDir := moduleDir(modules, pkg.ImportPath); dir != "" {
+			missing[dir] = struct{}{}
+			watchDirs[closestDir(dir, modDir)] = struct{}{}
+		}
+	}
+
+	d.memAccess.Lock()
+	defer d.memAccess.Unlock()
+
+	for dir := range watchDirs {
+		if _, ok := d.watchDirs[dir]; !ok {
+			added = append(added, dir)
+		}
+	}
+
+	for dir := range d.watchDirs {
+		if _, ok := watchDirs[dir]; !ok {
+			removed = append(removed, dir)
+		}
+	}
+
+	d.dirs = dirs
+	d.watchDirs = watchDirs
+	d.missing = missing
+	d.imports = imports
+	d.pkgImports = pkgImports
+
+	slices.Sort(added)
+	slices.Sort(removed)
+
+	return added, removed, nil
+}
+
+// moduleDir returns the directory of the package at importPath if it belongs to one of the local modules, along with
+// the module directory. it's empty if it doesn't.
+func moduleDir(modules map[string]string, importPath string) (dir string, modDir string) {
+	modPath := ""
+
+	// the longest module path wins, as modules can be nested
+	for path := range modules {
+		if (importPath == path || strings.HasPrefix(importPath, path+"/")) && len(path) > len(modPath) {
+			modPath = path
+		}
+	}
+
+	if modPath == "" {
+		return "", ""
+	}
+
+	rel := strings.TrimPrefix(strings.TrimPrefix(importPath, modPath), "/")
+
+	return filepath.Join(modules[modPath], filepath.FromSlash(rel)), modules[modPath]
+}
+
+// closestDir returns dir or it's closest existing parent, up to the module directory.
+func closestDir(dir string, modDir string) string {
+	for ; dir != modDir && isWithin(dir, modDir); dir = filepath.Dir(dir) {
+		if stat, err := os.Stat(dir); err == nil && stat.IsDir() {
+			return dir
+		}
+	}
+
+	return modDir
+}
+
+// WatchDirs returns the directories to watch, see depsGraph.watchDirs.
+func (d *depsGraph) WatchDirs() []string {
+	d.memAccess.RLock()
+	defer d.memAccess.RUnlock()
+
+	dirs := make([]string, 0, len(d.watchDirs))
+
+	for dir := range d.watchDirs {
+		dirs = append(dirs, dir)
+	}
+
+	slices.Sort(dirs)
+
+	return dirs
+}
+
+// Contains reports whether the go file at path belongs to a package in the closure.
+func (d *depsGraph) Contains(path string) bool {
+	return d.ContainsDir(filepath.Dir(path))
+}
+
+// ContainsDir reports whether the directory at path is the directory of a package in the closure.
+func (d *depsGraph) ContainsDir(path string) bool {
+	abs, err := filepath.Abs(path)
+
+	if err != nil {
+		return false
+	}
+
+	d.memAccess.RLock()
+	defer d.memAccess.RUnlock()
+
+	_, ok := d.dirs[abs]
+
+	return ok
+}
+
+// WatchesDir reports whether the directory at path should be watched: it's one of the directories to watch,
+// or the parent of a missing package.
+func (d *depsGraph) WatchesDir(path string) bool {
+	abs, err := filepath.Abs(path)
+
+	if err != nil {
+		return false
+	}
+
+	d.memAccess.RLock()
+	defer d.memAccess.RUnlock()
+
+	if _, ok := d.watchDirs[abs]; ok {
+		return true
+	}
+
+	for dir := range d.missing {
+		if isWithin(dir, abs) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NeedsRefresh reports whether the change to the file at path may change the closure: a change to the module &
+// workspace files, the creation of a missing package, or a change to the imports of a go file's package, added or removed,
+// since the last refresh. the packages outside the closure only change it if they import a package that is not in it.
+func (d *depsGraph) NeedsRefresh(path string) bool {
+	if slices.Contains(depsFiles, filepath.Base(path)) {
+		return true
+	}
+
+	abs, err := filepath.Abs(path)
+
+	if err != nil {
+		return false
+	}
+
+	// the missing package, or one of it's parents, is created
+	if d.isMissingDir(abs) {
+		return true
+	}
+
+	if filepath.Ext(abs) != ".go" {
+		return false
+	}
+
+	dir := filepath.Dir(abs)
+	imports, err := dirImports(dir)
+
+	d.memAccess.RLock()
+	defer d.memAccess.RUnlock()
+
+	// a go file of the missing package is created, it's imported by the closure but not in it
+	if _, ok := d.missing[dir]; ok {
+		return true
+	}
+
+	// the package is likely being edited, it's imports are checked on it's next change
+	if err != nil {
+		return false
+	}
+
+	if known, ok := d.pkgImports[dir]; ok {
+		return !slices.Equal(known, imports)
+	}
+
+	for _, importPath := range imports {
+		if _, ok := d.imports[importPath]; !ok && importPath != "C" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isMissingDir reports whether the directory at path is the expected directory of a missing package, or one of it's parents.
+func (d *depsGraph) isMissingDir(path string) bool {
+	d.memAccess.RLock()
+	defer d.memAccess.RUnlock()
+
+	for dir := range d.missing {
+		if isWithin(dir, path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// dirImports returns the sorted imports of the go files of the package in dir that the go command builds,
+// the test files are left out like `go list -deps` does. a directory without go files has no imports.
+func dirImports(dir string) ([]string, error) {
+	pkg, err := build.ImportDir(dir, 0)
+
+	if err != nil {
+		var noGoErr *build.NoGoError
+
+		if errors.As(err, &noGoErr) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return pkg.Imports, nil
+}
+
+// needsDepsRefresh reports whether the event may change the dependency graph, see depsGraph.NeedsRefresh.
+func (w *Watcher) needsDepsRefresh(e Event) bool {
+	return w.configs.deps != nil && e.Type != ChmodEvent && w.configs.deps.NeedsRefresh(e.Path)
+}
+
+// refreshDeps refreshes the dependency graph, and sends the changes of the directories to watch to Run.
+//
+// It's called by the debouncer of the refreshes, as `go list` is too slow to be run by Run between the events.
+// the refreshes are serialized, so they're applied in order.
+func (w *Watcher) refreshDeps() {
+	w.depsMemAccess.Lock()
+	defer w.depsMemAccess.Unlock()
+
+	update := depsUpdate{seq: w.depsRequests.Load()}
+	update.added, update.removed, update.err = w.configs.deps.refresh()
+
+	select {
+	case w.depsUpdates <- update:
+	case <-w.done:
+	}
+}
+
+// applyDepsUpdate watches the directories added to the dependency graph, and unwatches the ones removed from it.
+func (w *Watcher) applyDepsUpdate(u depsUpdate) error {
+	// the previous closure is kept, it's refreshed again on the next change
+	if u.err != nil {
+		w.warn(fmt.Errorf("error refreshing the dependency graph: %w", u.err))
+		return nil
+	}
+
+	// the subdirectories are not unwatched, they may be in the closure
+	for _, dir := range u.removed {
+		if slices.Contains(w.configs.filesDirs, dir) {
+			continue
+		}
+
+		if err := w.backend.Remove(w.configs.realPath(dir)); err != nil && !errors.Is(err, ErrNotWatched) && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	for _, dir := range u.added {
+		if w.isWatchedDir(dir) || w.configs.IsExcluded(dir, true) {
+			continue
+		}
+
+		if err := w.Watch(dir); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -1,43 +1,84 @@
-package watcher
-
-import (
-	"github.com/fsnotify/fsnotify"
-)
-
-type Event struct {
-	Path string
-	Type EventType
-}
-
-func NewEvent(t EventType, p string) *Event {
-	return &Event{
-		Path: p,
-		Type: t,
-	}
-}
-
-type EventType uint32
-
-type EventHandler func(Event)
-
-const (
-	// ChmodEvent is emitted when a File attributes was changed.
-	ChmodEvent = EventType(fsnotify.Chmod)
-
-	// WriteEvent is emitted when a pathname was written to; this does *not* mean the write has finished.
-	WriteEvent = EventType(fsnotify.Write)
-
-	// CreateEvent is emitted when a path(dir or file) was created
-	CreateEvent = EventType(fsnotify.Create)
-
-	// RemoveEvent is emitted when a path was removed; any watches on it will be removed.
-	RemoveEvent = EventType(fsnotify.Remove)
-
-	// RenameEvent is emitted when a path was renamed to something else;
-	// any watched on it will be removed.
-	RenameEvent = EventType(fsnotify.Rename)
-)
-
-func (e EventType) String() string {
-	return fsnotify.Op(e).String()
-}
+package watcher
+
+import (
+	"slices"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+type Event struct {
+	Path string
+	Type EventType
+}
+
+func NewEvent(t EventType, p string) *Event {
+	return &Event{
+		Path: p,
+		Type: t,
+	}
+}
+
+type EventType uint32
+
+type EventHandler func(Event)
+
+// Batch is the de-duplicated set of events received in between two debounced handler calls,
+// holding one event per path with the types of all the path's events combined, ordered by path.
+type Batch []Event
+
+// BatchHandler handles a batch of events.
+type BatchHandler func(Batch)
+
+// Contains reports whether the batch holds an event for path.
+func (b Batch) Contains(path string) bool {
+	return slices.ContainsFunc(b, func(e Event) bool {
+		return e.Path == path
+	})
+}
+
+// Event returns the event for path, or the last event of the batch if it holds no event for path.
+func (b Batch) Event(path string) Event {
+	if i := slices.IndexFunc(b, func(e Event) bool { return e.Path == path }); i >= 0 {
+		return b[i]
+	}
+
+	return b[len(b)-1]
+}
+
+// Paths returns the paths of the batch events.
+func (b Batch) Paths() []string {
+	paths := make([]string, len(b))
+
+	for i, e := range b {
+		paths[i] = e.Path
+	}
+
+	return paths
+}
+
+const (
+	// ChmodEvent is emitted when a File attributes was changed.
+	ChmodEvent = EventType(fsnotify.Chmod)
+
+	// WriteEvent is emitted when a pathname was written to; this does *not* mean the write has finished.
+	WriteEvent = EventType(fsnotify.Write)
+
+	// CreateEvent is emitted when a path(dir or file) was created
+	CreateEvent = EventType(fsnotify.Create)
+
+	// RemoveEvent is emitted when a path was removed; any watches on it will be removed.
+	RemoveEvent = EventType(fsnotify.Remove)
+
+	// RenameEvent is emitted when a path was renamed to something else;
+	// any watched on it will be removed.
+	RenameEvent = EventType(fsnotify.Rename)
+)
+
+// Has reports whether the event type includes t.
+func (e EventType) Has(t EventType) bool {
+	return e&t == t
+}
+
+func (e EventType) String() string {
+	return fsnotify.Op(e).String()
+}
@@ -0,0 +1,211 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/huboh/gwatch/internal/pkg/glob"
+)
+
+// Explanation describes whether a path is watched, and why.
+type Explanation struct {
+	// Path is the explained path
+	Path string
+
+	// IsDir is true if the path is a directory
+	IsDir bool
+
+	// Watched is true if the changes to the path trigger the event handlers, or if the directory is in the watch list
+	Watched bool
+
+	// Reason is the human readable reason of the decision
+	Reason string
+
+	// Rule is the include or exclude rule that made the decision, nil if no rule did
+	Rule *glob.Rule
+}
+
+func (e Explanation) String() string {
+	decision := "ignored"
+
+	if e.Watched {
+		decision = "watched"
+	}
+
+	return fmt.Sprintf("%s: %s, %s", decision, e.Path, e.Why())
+}
+
+// Why returns the reason of the decision, along with the rule that made it.
+func (e Explanation) Why() string {
+	if e.Rule != nil {
+		return fmt.Sprintf("%s by %s", e.Reason, e.Rule)
+	}
+
+	return e.Reason
+}
+
+// Explain explains whether the file or directory at path is watched, with the decision of IsWatched for files.
+//
+// Unlike IsWatched, it also checks that the path's directory is in the watch list.
+func (c *Configs) Explain(path string) Explanation {
+	stat, err := os.Stat(path)
+	isDir := err == nil && stat.IsDir()
+
+	if isDir {
+		return c.explainDir(path)
+	}
+
+	e := c.explainFile(path)
+
+	if e.Watched && !c.isWatchedPath(filepath.Dir(path)) {
+		e.Watched = false
+		e.Reason = "it matches the rules, but it's directory is not watched"
+	}
+
+	return e
+}
+
+// explainDir explains whether the directory at path is in the watch list.
+func (c *Configs) explainDir(path string) Explanation {
+	e := Explanation{Path: path, IsDir: true}
+
+	switch excluded, r := c.excludedBy(path, true); {
+	case c.isWatchedPath(path):
+		e.Watched = true
+		e.Reason = "the directory is in the watch list"
+
+	case excluded:
+		e.Reason = "the directory is excluded"
+		e.Rule = r
+
+	case c.inFilesDir(path):
+		e.Reason = "only the files listed in paths are watched in it's parent directory"
+
+	case c.deps != nil:
+		e.Reason = fmt.Sprintf("the directory is not in the dependency closure of %s", c.DepsTarget)
+
+	case !c.Recursive:
+		e.Reason = "the directory is not listed in paths, and recursive is disabled"
+
+	default:
+		e.Reason = "the directory is not under a watched path"
+	}
+
+	return e
+}
+
+// explainFile decides whether changes to the file at path trigger the event handlers, and explains why.
+// it's the decision of IsWatched.
+func (c *Configs) explainFile(path string) Explanation {
+	var (
+		e   = Explanation{Path: path}
+		ext = strings.TrimPrefix(filepath.Ext(path), ".")
+	)
+
+	if abs, err := filepath.Abs(path); err == nil && slices.Contains(c.Files, abs) {
+		e.Watched = true
+		e.Reason = "the file is listed in paths"
+
+		return e
+	}
+
+	if c.inFilesDir(path) {
+		e.Reason = "only the files listed in paths are watched in it's directory"
+		return e
+	}
+
+	if excluded, r := c.excludedBy(path, false); excluded {
+		e.Reason = "the file is excluded"
+		e.Rule = r
+
+		return e
+	}
+
+	if c.deps != nil && ext == "go" && !c.deps.Contains(path) {
+		e.Reason = fmt.Sprintf("the file's package is not in the dependency closure of %s", c.DepsTarget)
+		return e
+	}
+
+	if c.deps != nil && !c.deps.WatchesDir(filepath.Dir(path)) {
+		e.Reason = fmt.Sprintf("the file's directory is not in the dependency closure of %s", c.DepsTarget)
+		return e
+	}
+
+	// the last Include pattern matching the file decides, a negated pattern (`!pattern`) drops it.
+	// if none matches, the file is watched if we're watching it's extension
+	switch r := c.includeRules.Match(c.relPath(path), false); {
+	case r != nil && r.Negate:
+		e.Reason = "the file is dropped"
+		e.Rule = r
+
+	case r != nil:
+		e.Watched = true
+		e.Reason = "the file is included"
+		e.Rule = r
+
+	case ext == "":
+		e.Reason = "the file has no extension, and no include pattern matches it"
+
+	case slices.Contains(c.Exts, ext):
+		e.Watched = true
+		e.Reason = fmt.Sprintf("the .%s extension is watched", ext)
+
+	default:
+		e.Reason = fmt.Sprintf("the .%s extension is not in exts %v, and no include pattern matches it", ext, c.Exts)
+	}
+
+	return e
+}
+
+// isWatchedPath reports whether the directory at path is in Paths.
+func (c *Configs) isWatchedPath(path string) bool {
+	abs, err := filepath.Abs(path)
+
+	if err != nil {
+		return false
+	}
+
+	return slices.ContainsFunc(c.Paths, func(p string) bool {
+		p, err := filepath.Abs(p)
+		return err == nil && p == abs
+	})
+}
+
+// trace delivers the event & the decision made for it to the trace handler, if any.
+func (w *Watcher) trace(e Event, decision string) {
+	if w.traceHandler != nil {
+		w.traceHandler(e, decision)
+	}
+}
+
+// dropReason returns why the event was not dispatched, see shouldDispatch.
+func (w *Watcher) dropReason(e Event) string {
+	switch {
+	case e.Type.Has(RemoveEvent), e.Type.Has(RenameEvent):
+		return "the path was not a watched file or directory"
+
+	case e.Type.Has(WriteEvent), e.Type.Has(CreateEvent):
+		stat, err := w.stat(e.Path)
+
+		switch {
+		case err != nil:
+			return "the path no longer exists"
+
+		case stat.IsDir() && e.Type.Has(CreateEvent):
+			return "the created directory holds no watched file"
+
+		case stat.IsDir():
+			return "the directory write events are not dispatched"
+
+		case !stat.Mode().IsRegular():
+			return "the path is not a regular file"
+		}
+
+		return w.configs.explainFile(e.Path).Why()
+	}
+
+	return fmt.Sprintf("%s events are not dispatched", e.Type)
+}
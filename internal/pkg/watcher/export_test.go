@@ -0,0 +1,20 @@
+package watcher
+
+import "time"
+
+// SetNewBackend replaces the backend created by New, it returns a function restoring NewBackend.
+func SetNewBackend(f func(kind string, pollInterval time.Duration) (Backend, error)) (restore func()) {
+	newBackend = f
+
+	return func() { newBackend = NewBackend }
+}
+
+// NewAutoBackendOver creates the auto backend watching the paths with the preferred backend, until it reaches the limit of watches.
+func NewAutoBackendOver(preferred Backend, pollInterval time.Duration) Backend {
+	return newAutoBackendOver(preferred, pollInterval)
+}
+
+// Prioritized returns the paths to watch from the most important to the least.
+func (c *Configs) Prioritized() []string {
+	return c.prioritized()
+}
@@ -0,0 +1,202 @@
+package watcher
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Fingerprint identifies the content of a file.
+type Fingerprint struct {
+	// Size is the file size in bytes
+	Size int64 `json:"size"`
+
+	// ModTime is the file modification time
+	ModTime time.Time `json:"mod_time"`
+
+	// Hash is the hex encoded sha256 hash of the file content
+	Hash string `json:"hash"`
+
+	// version identifies the content, it changes each time the hash changes.
+	// primed fingerprints are version 0, so their content is the one every subscriber has seen.
+	version uint64
+}
+
+// Fingerprints is the cache of the watched files content fingerprints, used to drop events of files whose content did not change.
+//
+// the size & modification time of a file are compared first, the file is only hashed when they changed.
+type Fingerprints struct {
+	// stateFile is the file the fingerprints are persisted to, it's empty if they're only kept in memory
+	stateFile string
+
+	// persisted is the fingerprints read from the state file
+	persisted map[string]Fingerprint
+
+	// entries is the current fingerprint of each file, keyed by the file path
+	entries map[string]Fingerprint
+
+	// entriesMemAccess prevent concurrent access to the entries
+	entriesMemAccess *sync.Mutex
+
+	// version is the last version given to a content
+	version uint64
+}
+
+// newFingerprints creates the fingerprints cache, reading the fingerprints previously persisted to stateFile if it's not empty.
+func newFingerprints(stateFile string) *Fingerprints {
+	f := &Fingerprints{
+		stateFile:        stateFile,
+		persisted:        make(map[string]Fingerprint),
+		entries:          make(map[string]Fingerprint),
+		entriesMemAccess: new(sync.Mutex),
+	}
+
+	if stateFile != "" {
+		// a missing or corrupted state file is the same as no previous state
+		if byts, err := os.ReadFile(stateFile); err == nil {
+			json.Unmarshal(byts, &f.persisted)
+		}
+	}
+
+	return f
+}
+
+// Prime records the fingerprint of the file without reporting changes, reusing the persisted fingerprint
+// if the file size & modification time did not change since it was persisted.
+func (f *Fingerprints) Prime(path string, stat fs.FileInfo) error {
+	f.entriesMemAccess.Lock()
+	defer f.entriesMemAccess.Unlock()
+
+	if prev, ok := f.persisted[path]; ok && prev.Size == stat.Size() && prev.ModTime.Equal(stat.ModTime()) {
+		f.entries[path] = prev
+		return nil
+	}
+
+	fp, err := newFingerprint(path, stat)
+
+	if err != nil {
+		return err
+	}
+
+	f.entries[path] = fp
+
+	return nil
+}
+
+// Update updates the fingerprint of the file and returns the version of it's content.
+// the version only changes when the content changes, it's never the same for a new content.
+func (f *Fingerprints) Update(path string, stat fs.FileInfo) (uint64, error) {
+	f.entriesMemAccess.Lock()
+	defer f.entriesMemAccess.Unlock()
+
+	prev, ok := f.entries[path]
+
+	if ok && prev.Size == stat.Size() && prev.ModTime.Equal(stat.ModTime()) {
+		return prev.version, nil
+	}
+
+	fp, err := newFingerprint(path, stat)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if ok && prev.Hash == fp.Hash {
+		fp.version = prev.version
+	} else {
+		f.version++
+		fp.version = f.version
+	}
+
+	f.entries[path] = fp
+
+	return fp.version, nil
+}
+
+// Forget drops the fingerprint of the removed file.
+func (f *Fingerprints) Forget(path string) {
+	f.entriesMemAccess.Lock()
+	defer f.entriesMemAccess.Unlock()
+
+	delete(f.entries, path)
+}
+
+// Unchanged reports whether the files content is byte-identical to the persisted fingerprints.
+// it's always false if the fingerprints are not persisted, or there are no persisted fingerprints yet.
+func (f *Fingerprints) Unchanged() bool {
+	if f == nil || len(f.persisted) == 0 {
+		return false
+	}
+
+	f.entriesMemAccess.Lock()
+	defer f.entriesMemAccess.Unlock()
+
+	return maps.EqualFunc(f.entries, f.persisted, func(a, b Fingerprint) bool {
+		return a.Hash == b.Hash
+	})
+}
+
+// Save persists the current fingerprints to the state file, it's a no-op if the fingerprints are only kept in memory.
+func (f *Fingerprints) Save() error {
+	if f == nil || f.stateFile == "" {
+		return nil
+	}
+
+	f.entriesMemAccess.Lock()
+	entries := maps.Clone(f.entries)
+	f.entriesMemAccess.Unlock()
+
+	byts, err := json.Marshal(entries)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(f.stateFile), 0o755); err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so a crash never leaves a partially written state file
+	tmp := f.stateFile + ".tmp"
+
+	if err := os.WriteFile(tmp, byts, 0o644); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, f.stateFile); err != nil {
+		return errors.Join(err, os.Remove(tmp))
+	}
+
+	return nil
+}
+
+// newFingerprint hashes the content of the file at path.
+func newFingerprint(path string, stat fs.FileInfo) (Fingerprint, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return Fingerprint{}, err
+	}
+
+	defer file.Close()
+
+	hash := sha256.New()
+
+	if _, err := io.Copy(hash, file); err != nil {
+		return Fingerprint{}, err
+	}
+
+	return Fingerprint{
+		Size:    stat.Size(),
+		ModTime: stat.ModTime(),
+		Hash:    hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
@@ -0,0 +1,89 @@
+package watcher
+
+import (
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+var (
+	// gitMarkers is the list of the paths, relative to the git directory, that exist while a git operation runs:
+	// the index lock of checkouts, stashes & resets, and the state of rebases, merges, cherry-picks & reverts.
+	gitMarkers = []string{"index.lock", "rebase-merge", "rebase-apply", "MERGE_HEAD", "CHERRY_PICK_HEAD", "REVERT_HEAD"}
+
+	// defaultGitLockTimeout is the lock timeout used if Configs.GitLockTimeout is not set.
+	defaultGitLockTimeout = time.Second * 30
+)
+
+// isGitEvent reports whether the event is for an entry of the git directory, see gitMarkers.
+func (w *Watcher) isGitEvent(e Event) bool {
+	return w.gitDir != "" && filepath.Dir(filepath.Clean(e.Path)) == w.gitDir
+}
+
+// gitLockTimeout returns the time without changes after which an index lock is considered stale.
+func (w *Watcher) gitLockTimeout() time.Duration {
+	if w.configs.GitLockTimeout > 0 {
+		return w.configs.GitLockTimeout
+	}
+
+	return defaultGitLockTimeout
+}
+
+// gitOperationRunning reports whether one of the git markers exists.
+//
+// the state of rebases, merges, cherry-picks & reverts runs the operation until it's removed, whatever it's age.
+// an index lock alone is only stale once it's older than the lock timeout & no file changed for as long,
+// so a long checkout that keeps rewriting files is still running.
+func (w *Watcher) gitOperationRunning() bool {
+	return slices.ContainsFunc(gitMarkers, func(marker string) bool {
+		stat, err := w.stat(filepath.Join(w.gitDir, marker))
+
+		if err != nil {
+			return false
+		}
+
+		if marker != "index.lock" {
+			return true
+		}
+
+		timeout := w.gitLockTimeout()
+		lastChange := time.Unix(0, w.lastChange.Load())
+
+		return time.Since(stat.ModTime()) < timeout || time.Since(lastChange) < timeout
+	})
+}
+
+// syncGitOperation holds the deliveries to the handlers when a git operation starts, and releases them once it's done,
+// so the files it rewrites trigger a single delivery. It reports whether a git operation is running.
+func (w *Watcher) syncGitOperation() bool {
+	running := w.gitOperationRunning()
+
+	if w.gitRunning.Swap(running) == running {
+		return running
+	}
+
+	for _, sub := range w.subscriptions {
+		if running {
+			sub.hold()
+		} else {
+			sub.release()
+		}
+	}
+
+	if w.gitHandler != nil {
+		go w.gitHandler(running)
+	}
+
+	return running
+}
+
+// GitOperationRunning reports whether a git operation is running, in which case the deliveries to the handlers are held.
+func (w *Watcher) GitOperationRunning() bool {
+	return w.gitRunning.Load()
+}
+
+// OnGitOperation sets a handler called when a git operation starts and ends, the deliveries to the handlers
+// added with OnEvent & OnBatch are held while it runs. It must be set before calling Listen.
+func (w *Watcher) OnGitOperation(h func(running bool)) {
+	w.gitHandler = h
+}
@@ -0,0 +1,174 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/huboh/gwatch/internal/pkg/git"
+	"github.com/huboh/gwatch/internal/pkg/glob"
+)
+
+// gitSource is the watch set of SourceGit: the files tracked in the git index, and the untracked files git doesn't ignore.
+type gitSource struct {
+	// workTree is the absolute path of the repository's work tree
+	workTree string
+
+	// index is the path of the repository's index file
+	index string
+
+	// ignoreFiles is the rules of the repository's .gitignore files & .git/info/exclude
+	ignoreFiles *ignoreFiles
+
+	// tracked is the set of the tracked files absolute paths
+	tracked map[string]bool
+
+	// dirs is the set of the directories containing tracked files, at any depth
+	dirs map[string]bool
+
+	// memAccess prevent concurrent access to the tracked files & dirs
+	memAccess *sync.RWMutex
+}
+
+func newGitSource(dir string) (*gitSource, error) {
+	abs, err := filepath.Abs(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	workTree, gitDir := git.FindRepo(abs)
+
+	if gitDir == "" {
+		return nil, fmt.Errorf("git requires a git repository, %s is not in one", dir)
+	}
+
+	s := &gitSource{
+		workTree:    workTree,
+		index:       filepath.Join(gitDir, "index"),
+		ignoreFiles: newIgnoreFiles(workTree, gitIgnoreFileNames),
+		memAccess:   new(sync.RWMutex),
+	}
+
+	return s, s.Refresh()
+}
+
+// Refresh reads the tracked files from the index file again.
+func (s *gitSource) Refresh() error {
+	paths, err := git.ReadIndex(s.index)
+
+	// the index is only created once the first files are added
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var (
+		tracked = make(map[string]bool, len(paths))
+		dirs    = make(map[string]bool)
+	)
+
+	for _, p := range paths {
+		path := filepath.Join(s.workTree, filepath.FromSlash(p))
+		tracked[path] = true
+
+		for dir := filepath.Dir(path); dir != s.workTree && !dirs[dir]; dir = filepath.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+
+	s.memAccess.Lock()
+	defer s.memAccess.Unlock()
+
+	s.tracked, s.dirs = tracked, dirs
+
+	return nil
+}
+
+// IsIndex reports whether path is the repository's index file.
+func (s *gitSource) IsIndex(path string) bool {
+	return filepath.Clean(path) == s.index
+}
+
+// Dirs returns the directories containing tracked files, at any depth.
+func (s *gitSource) Dirs() []string {
+	s.memAccess.RLock()
+	defer s.memAccess.RUnlock()
+
+	dirs := make([]string, 0, len(s.dirs))
+
+	for dir := range s.dirs {
+		dirs = append(dirs, dir)
+	}
+
+	slices.Sort(dirs)
+
+	return dirs
+}
+
+// Excludes reports whether the path is ignored by git, along with the rule that ignored it.
+// the tracked files, and the directories containing them, are never ignored. neither are the paths outside the work tree.
+func (s *gitSource) Excludes(path string, isDir bool) (bool, *glob.Rule) {
+	abs, err := filepath.Abs(path)
+
+	if err != nil {
+		return false, nil
+	}
+
+	s.memAccess.RLock()
+	tracked := s.tracked[abs] || isDir && s.dirs[abs]
+	s.memAccess.RUnlock()
+
+	if tracked {
+		return false, nil
+	}
+
+	return s.ignoreFiles.Excludes(s.relPath(abs), isDir)
+}
+
+// Forget drops the cached rules of the .gitignore file at path, see ignoreFiles.Forget.
+func (s *gitSource) Forget(path string) {
+	if abs, err := filepath.Abs(path); err == nil {
+		s.ignoreFiles.Forget(s.relPath(abs))
+	}
+}
+
+// relPath returns the slash separated path relative to the work tree.
+func (s *gitSource) relPath(abs string) string {
+	rel, err := filepath.Rel(s.workTree, abs)
+
+	if err != nil {
+		return filepath.ToSlash(abs)
+	}
+
+	return filepath.ToSlash(rel)
+}
+
+// refreshGitSource reads the tracked files again when the index file changes, and watches the directories
+// of the newly tracked files that were ignored.
+func (w *Watcher) refreshGitSource(e Event) error {
+	if w.configs.git == nil || !w.configs.git.IsIndex(e.Path) {
+		return nil
+	}
+
+	if err := w.configs.git.Refresh(); err != nil {
+		return err
+	}
+
+	if !w.configs.Recursive {
+		return nil
+	}
+
+	var dirs []string
+
+	for _, dir := range w.configs.git.Dirs() {
+		if w.isWatchedDir(dir) || w.configs.IsExcluded(dir, true) || !w.configs.underRootPaths(dir) {
+			continue
+		}
+
+		dirs = append(dirs, dir)
+	}
+
+	return w.Watch(dirs...)
+}
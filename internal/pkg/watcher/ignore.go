@@ -0,0 +1,167 @@
+package watcher
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/huboh/gwatch/internal/pkg/glob"
+)
+
+var (
+	// ignoreFileNames is the list of ignore files read at each directory level.
+	ignoreFileNames = []string{".gitignore", ".ignore", ".gwatchignore"}
+
+	// gitIgnoreFileNames is the list of ignore files git reads at each directory level.
+	gitIgnoreFileNames = []string{".gitignore"}
+
+	// rootIgnoreFileNames is the list of ignore files only read at the root directory.
+	rootIgnoreFileNames = []string{filepath.Join(".git", "info", "exclude")}
+)
+
+// ignoreFiles loads and caches the rules of the ignore files found in each directory under the root directory.
+type ignoreFiles struct {
+	// root is the absolute path of the root directory
+	root string
+
+	// names is the list of ignore files read at each directory level
+	names []string
+
+	// rules is the cache of each directory's own rules, keyed by the directory's slash separated relative path.
+	rules map[string]glob.Rules
+
+	// rulesMemAccess prevent concurrent access to the rules cache.
+	rulesMemAccess *sync.RWMutex
+}
+
+func newIgnoreFiles(root string, names []string) *ignoreFiles {
+	return &ignoreFiles{
+		root:           root,
+		names:          names,
+		rules:          make(map[string]glob.Rules),
+		rulesMemAccess: new(sync.RWMutex),
+	}
+}
+
+// Excludes reports whether the slash separated path relative to the root directory is ignored.
+//
+// Like git, rules of deeper ignore files take precedence over the ones above them,
+// and a path can not be re-included if one of it's parent directories is ignored.
+func (i *ignoreFiles) Excludes(rel string, isDir bool) (bool, *glob.Rule) {
+	rel = path.Clean(rel)
+
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+		return false, nil
+	}
+
+	for j := 0; j < len(rel); j++ {
+		if rel[j] != '/' {
+			continue
+		}
+
+		if r := i.dirRules(path.Dir(rel[:j])).Match(rel[:j], true); r != nil && !r.Negate {
+			return true, r
+		}
+	}
+
+	r := i.dirRules(path.Dir(rel)).Match(rel, isDir)
+
+	return r != nil && !r.Negate, r
+}
+
+// Forget drops the cached rules of the directory containing the ignore file at the slash separated relative path,
+// so it is read again on next use. It reports whether rel is an ignore file.
+func (i *ignoreFiles) Forget(rel string) bool {
+	rel = path.Clean(rel)
+
+	if !i.isIgnoreFile(rel) {
+		return false
+	}
+
+	dir := path.Dir(rel)
+
+	// the root ignore files are nested in the .git directory
+	if isRootIgnoreFile(rel) {
+		dir = "."
+	}
+
+	i.rulesMemAccess.Lock()
+	defer i.rulesMemAccess.Unlock()
+
+	delete(i.rules, dir)
+
+	return true
+}
+
+// dirRules returns the rules applying to the entries of dir, from the root directory down to dir.
+func (i *ignoreFiles) dirRules(dir string) glob.Rules {
+	var rules glob.Rules
+
+	if dir != "." {
+		rules = append(rules, i.dirRules(path.Dir(dir))...)
+	}
+
+	return append(rules, i.ownRules(dir)...)
+}
+
+// ownRules returns the rules read from the ignore files in dir.
+func (i *ignoreFiles) ownRules(dir string) glob.Rules {
+	i.rulesMemAccess.RLock()
+	rules, cached := i.rules[dir]
+	i.rulesMemAccess.RUnlock()
+
+	if cached {
+		return rules
+	}
+
+	names := i.names
+
+	if dir == "." {
+		names = slices.Concat(rootIgnoreFileNames, i.names)
+	}
+
+	for _, name := range names {
+		rel := path.Join(dir, filepath.ToSlash(name))
+		byts, err := os.ReadFile(filepath.Join(i.root, filepath.FromSlash(rel)))
+
+		if err != nil {
+			continue
+		}
+
+		scanner := bufio.NewScanner(bytes.NewReader(byts))
+
+		for scanner.Scan() {
+			// invalid lines are skipped like git does
+			if r, err := glob.NewRule(dir, rel, strings.TrimRight(scanner.Text(), "\r")); err == nil && r != nil {
+				rules = append(rules, r)
+			}
+		}
+	}
+
+	i.rulesMemAccess.Lock()
+	i.rules[dir] = rules
+	i.rulesMemAccess.Unlock()
+
+	return rules
+}
+
+// isIgnoreFile reports whether the slash separated relative path is one of the ignore files.
+func (i *ignoreFiles) isIgnoreFile(rel string) bool {
+	return isRootIgnoreFile(rel) || slices.Contains(i.names, path.Base(rel))
+}
+
+// isRootIgnoreFile reports whether the slash separated relative path is one of the root directory ignore files.
+func isRootIgnoreFile(rel string) bool {
+	for _, name := range rootIgnoreFileNames {
+		if rel == filepath.ToSlash(name) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,41 @@
+//go:build linux
+
+package watcher
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// watchLimitFile is the file holding the inotify limit of watches per user.
+const watchLimitFile = "/proc/sys/fs/inotify/max_user_watches"
+
+// isWatchLimitErr reports whether err is inotify's error for a reached `max_user_watches` limit.
+func isWatchLimitErr(err error) bool {
+	return errors.Is(err, syscall.ENOSPC)
+}
+
+// watchLimit returns the inotify limit of watches per user, or zero if it can't be read.
+func watchLimit() int {
+	byts, err := os.ReadFile(watchLimitFile)
+
+	if err != nil {
+		return 0
+	}
+
+	limit, err := strconv.Atoi(strings.TrimSpace(string(byts)))
+
+	if err != nil {
+		return 0
+	}
+
+	return limit
+}
+
+// watchLimitHint returns how to raise the limit of watches.
+func watchLimitHint() string {
+	return "raise it with `sudo sysctl fs.inotify.max_user_watches=<limit>`"
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package watcher
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isWatchLimitErr reports whether err is kqueue's error for a reached limit of open files, one is opened per watched path.
+func isWatchLimitErr(err error) bool {
+	return errors.Is(err, syscall.EMFILE)
+}
+
+// watchLimit returns the limit of watches, it's zero as it's not known on this os.
+func watchLimit() int {
+	return 0
+}
+
+// watchLimitHint returns how to raise the limit of watches.
+func watchLimitHint() string {
+	return "raise the limit of open files with `ulimit -n <limit>`"
+}
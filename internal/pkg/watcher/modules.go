@@ -0,0 +1,81 @@
+package watcher
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+
+	"github.com/huboh/gwatch/internal/pkg/gomod"
+)
+
+// isModuleFile reports whether path is the go.mod or go.work file the local modules are read from.
+func (c *Configs) isModuleFile(path string) bool {
+	abs, err := filepath.Abs(path)
+
+	if err != nil {
+		return false
+	}
+
+	root, err := filepath.Abs(c.RootDir)
+
+	if err != nil {
+		return false
+	}
+
+	return abs == filepath.Join(root, "go.mod") || abs == gomod.WorkFile(root)
+}
+
+// refreshLocalModules reads the local modules again when the go.mod or go.work file changes,
+// watching the added modules and unwatching the removed ones.
+func (w *Watcher) refreshLocalModules(e Event) error {
+	if !w.configs.WatchLocalModules || e.Type == ChmodEvent || !w.configs.isModuleFile(e.Path) {
+		return nil
+	}
+
+	modules, err := gomod.LocalModules(w.configs.RootDir)
+
+	// the file is likely being edited, the previous modules are kept until it's valid again
+	if err != nil {
+		w.warn(fmt.Errorf("error reading the local modules, keeping the previous ones: %w", err))
+		return nil
+	}
+
+	// the dependency graph is refreshed along with the modules, it watches the directories of the modules the app is built from
+	if w.configs.deps != nil {
+		w.configs.LocalModules = modules
+		return nil
+	}
+
+	// the dropped modules are unwatched along with their subdirectories, unless they're under the watched paths
+	for _, dir := range w.configs.LocalModules {
+		if !slices.Contains(modules, dir) && !w.configs.underRootPaths(dir) {
+			if err := w.Unwatch(dir); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, dir := range modules {
+		if slices.Contains(w.configs.LocalModules, dir) {
+			continue
+		}
+
+		dirs := []string{dir}
+
+		if w.configs.Recursive {
+			dirs = dirs[:0]
+
+			if err := w.configs.walkDirs(dir, func(d string) { dirs = append(dirs, d) }); err != nil {
+				return err
+			}
+		}
+
+		if err := w.Watch(dirs...); err != nil {
+			return err
+		}
+	}
+
+	w.configs.LocalModules = modules
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package watcher
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// recordFile is the kind of a regular file in a recorded session
+	recordFile = "file"
+
+	// recordDir is the kind of a directory in a recorded session
+	recordDir = "dir"
+
+	// recordMissing is the kind of a path that no longer existed when it's event was recorded
+	recordMissing = "missing"
+
+	// recordOther is the kind of the other files, like symbolic links & devices
+	recordOther = "other"
+)
+
+// eventTypeNames maps the event types to their name in a recorded session.
+var eventTypeNames = map[EventType]string{
+	CreateEvent: "CREATE",
+	WriteEvent:  "WRITE",
+	RemoveEvent: "REMOVE",
+	RenameEvent: "RENAME",
+	ChmodEvent:  "CHMOD",
+}
+
+// record is an event of a recorded session, written as a json line to the session file.
+type record struct {
+	// Offset is the time elapsed since the session started
+	Offset time.Duration `json:"offset"`
+
+	// Type is the names of the event types, separated by a `|`, like "CREATE|WRITE"
+	Type string `json:"type"`
+
+	// Path is the slash separated path relative to the root directory, or the absolute path if it's outside of it
+	Path string `json:"path"`
+
+	// Kind is the kind of the path when the event was recorded, one of "file", "dir", "missing" or "other"
+	Kind string `json:"kind"`
+
+	// Size is the size of the file when the event was recorded
+	Size int64 `json:"size,omitempty"`
+
+	// ModTime is the modification time of the path when the event was recorded
+	ModTime time.Time `json:"mod_time,omitempty"`
+}
+
+// newRecord records the event received after the offset, along with the state of it's path.
+func newRecord(root string, offset time.Duration, e Event) record {
+	r := record{
+		Offset: offset,
+		Type:   formatEventType(e.Type),
+		Path:   filepath.ToSlash(e.Path),
+		Kind:   recordMissing,
+	}
+
+	if rel, err := filepath.Rel(root, e.Path); err == nil && !strings.HasPrefix(rel, "..") {
+		r.Path = filepath.ToSlash(rel)
+	}
+
+	if stat, err := os.Stat(e.Path); err == nil {
+		r.Size = stat.Size()
+		r.ModTime = stat.ModTime()
+
+		switch {
+		case stat.Mode().IsRegular():
+			r.Kind = recordFile
+
+		case stat.IsDir():
+			r.Kind = recordDir
+
+		default:
+			r.Kind = recordOther
+		}
+	}
+
+	return r
+}
+
+// event returns the recorded event, with it's path resolved against the root directory.
+func (r record) event(root string) (Event, error) {
+	eType, err := parseEventType(r.Type)
+
+	if err != nil {
+		return Event{}, err
+	}
+
+	path := filepath.FromSlash(r.Path)
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+
+	return *NewEvent(eType, path), nil
+}
+
+// stat returns the recorded state of the path, like os.Stat does.
+func (r record) stat(path string) (fs.FileInfo, error) {
+	info := recordInfo{name: filepath.Base(path), size: r.Size, modTime: r.ModTime}
+
+	switch r.Kind {
+	case recordFile:
+		info.mode = 0o644
+
+	case recordDir:
+		info.mode = fs.ModeDir | 0o755
+
+	case recordOther:
+		info.mode = fs.ModeIrregular
+
+	default:
+		return nil, &fs.PathError{Op: "stat", Path: path, Err: fs.ErrNotExist}
+	}
+
+	return info, nil
+}
+
+// recordInfo is the fs.FileInfo of a path in a recorded session.
+type recordInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (i recordInfo) Name() string       { return i.name }
+func (i recordInfo) Size() int64        { return i.size }
+func (i recordInfo) Mode() fs.FileMode  { return i.mode }
+func (i recordInfo) ModTime() time.Time { return i.modTime }
+func (i recordInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i recordInfo) Sys() any           { return nil }
+
+// formatEventType returns the names of the event types, separated by a `|`.
+func formatEventType(t EventType) string {
+	var names []string
+
+	for _, eType := range []EventType{CreateEvent, WriteEvent, RemoveEvent, RenameEvent, ChmodEvent} {
+		if t.Has(eType) {
+			names = append(names, eventTypeNames[eType])
+		}
+	}
+
+	return strings.Join(names, "|")
+}
+
+// parseEventType parses the names of event types separated by a `|`, as formatted by formatEventType.
+func parseEventType(s string) (EventType, error) {
+	var t EventType
+
+	for _, name := range strings.Split(s, "|") {
+		found := false
+
+		for eType, eName := range eventTypeNames {
+			if eName == name {
+				t |= eType
+				found = true
+			}
+		}
+
+		if !found {
+			return 0, fmt.Errorf("unknown event type %q", name)
+		}
+	}
+
+	return t, nil
+}
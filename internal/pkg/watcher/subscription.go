@@ -0,0 +1,207 @@
+package watcher
+
+import (
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/huboh/gwatch/internal/pkg/debounce"
+)
+
+// allEvents matches every event type.
+const allEvents = ^EventType(0)
+
+// subscription is a registered handler, along with it's own pending batch and debouncer,
+// so handlers never drop each other's events.
+type subscription struct {
+	// types is the event types the subscription receives
+	types EventType
+
+	// handle is the handler the debounced batches are delivered to
+	handle BatchHandler
+
+	// handleEvent is the handler the last event of the debounced batches is delivered to, used instead of handle if not nil
+	handleEvent EventHandler
+
+	// batch is the set of events received since the last delivery, their type combined per path
+	batch map[string]EventType
+
+	// batchMemAccess prevent concurrent access to the batch & seen versions
+	batchMemAccess *sync.Mutex
+
+	// seen is the content version of the files delivered to the handler, see Fingerprints.Update
+	seen map[string]uint64
+
+	// debouncer delays the delivery of the batch
+	debouncer *debounce.Debouncer
+
+	// fingerprints is the watched files content fingerprints, nil if SkipUnchanged is disabled
+	fingerprints *Fingerprints
+
+	// last is the path of the last event received
+	last string
+
+	// paused holds the deliveries, the events keep being added to the batch
+	paused bool
+
+	// held holds the deliveries during a git operation, like paused
+	held bool
+
+	// trace is called with the events dropped by the content check, the events are not traced if it's nil
+	trace func(Event, string)
+
+	// stat returns the state of the files for the content check, from the watcher's backend
+	stat func(string) (fs.FileInfo, error)
+}
+
+func newSubscription(types EventType, handle BatchHandler, handleEvent EventHandler, opts debounce.Options, fingerprints *Fingerprints) *subscription {
+	s := &subscription{
+		types:          types,
+		handle:         handle,
+		handleEvent:    handleEvent,
+		batch:          make(map[string]EventType),
+		batchMemAccess: new(sync.Mutex),
+		seen:           make(map[string]uint64),
+		fingerprints:   fingerprints,
+		stat:           os.Stat,
+	}
+
+	s.debouncer = debounce.New(s.flush, opts)
+
+	return s
+}
+
+// add adds the event to the pending batch if the subscription receives it's type, it reports whether it did.
+func (s *subscription) add(e Event) bool {
+	if e.Type&s.types == 0 {
+		return false
+	}
+
+	s.batchMemAccess.Lock()
+	s.batch[e.Path] |= e.Type
+	s.last = e.Path
+	s.batchMemAccess.Unlock()
+
+	s.debouncer.Trigger()
+
+	return true
+}
+
+// flush delivers the pending batch to the handler, without the files whose content the handler already saw.
+// the batch is kept for later while the subscription is paused or held.
+func (s *subscription) flush() {
+	s.batchMemAccess.Lock()
+	defer s.batchMemAccess.Unlock()
+
+	if s.paused || s.held {
+		return
+	}
+
+	changes := make(Batch, 0, len(s.batch))
+
+	for path, eType := range s.batch {
+		e := *NewEvent(eType, path)
+
+		if !s.contentChanged(e) {
+			if s.trace != nil {
+				s.trace(e, "dropped, the content is unchanged since the last delivery")
+			}
+
+			continue
+		}
+
+		changes = append(changes, e)
+	}
+
+	s.batch = make(map[string]EventType)
+
+	if len(changes) == 0 {
+		return
+	}
+
+	slices.SortFunc(changes, func(a, b Event) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	if s.handleEvent != nil {
+		go s.handleEvent(changes.Event(s.last))
+	} else {
+		go s.handle(changes)
+	}
+}
+
+// contentChanged reports whether the content of the file changed since it was last delivered to the handler,
+// dropping the events of files whose content is byte-identical, like the ones from formatters, `touch` or git checkouts.
+//
+// it always reports true for removed files & directories, or if SkipUnchanged is disabled.
+// the caller must hold batchMemAccess.
+func (s *subscription) contentChanged(e Event) bool {
+	if s.fingerprints == nil {
+		return true
+	}
+
+	stat, err := s.stat(e.Path)
+
+	if err != nil || !stat.Mode().IsRegular() {
+		delete(s.seen, e.Path)
+		return true
+	}
+
+	version, err := s.fingerprints.Update(e.Path, stat)
+
+	if err != nil {
+		return true
+	}
+
+	if seen, ok := s.seen[e.Path]; ok && seen == version || !ok && version == 0 {
+		return false
+	}
+
+	s.seen[e.Path] = version
+
+	return true
+}
+
+// pause holds the deliveries until resume is called.
+func (s *subscription) pause() {
+	s.batchMemAccess.Lock()
+	defer s.batchMemAccess.Unlock()
+
+	s.paused = true
+}
+
+// resume delivers the events received while paused at once, if any, and delivers the next ones as usual.
+func (s *subscription) resume() {
+	s.batchMemAccess.Lock()
+	s.paused = false
+	s.batchMemAccess.Unlock()
+
+	s.flush()
+}
+
+// hold holds the deliveries until release is called.
+func (s *subscription) hold() {
+	s.batchMemAccess.Lock()
+	defer s.batchMemAccess.Unlock()
+
+	s.held = true
+}
+
+// release delivers the events received while held once the debouncing wait elapsed, if any.
+func (s *subscription) release() {
+	s.batchMemAccess.Lock()
+	s.held = false
+	pending := len(s.batch) > 0
+	s.batchMemAccess.Unlock()
+
+	if pending {
+		s.debouncer.Trigger()
+	}
+}
+
+// stop cancels the pending delivery.
+func (s *subscription) stop() {
+	s.debouncer.Stop()
+}
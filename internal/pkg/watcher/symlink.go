@@ -0,0 +1,122 @@
+package watcher
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// symlinks maps the real directories of the followed symbolic links to the link paths,
+// so the real directories are watched while the events are reported under the paths the user knows.
+type symlinks struct {
+	// links is the link path of each followed real directory, keyed by the real directory path
+	links map[string]string
+
+	// memAccess prevent concurrent access to the links
+	memAccess *sync.RWMutex
+}
+
+func newSymlinks() *symlinks {
+	return &symlinks{
+		links:     make(map[string]string),
+		memAccess: new(sync.RWMutex),
+	}
+}
+
+// Add records that the real directory is reached from the link path.
+func (s *symlinks) Add(real, link string) {
+	s.memAccess.Lock()
+	defer s.memAccess.Unlock()
+
+	s.links[filepath.Clean(real)] = filepath.Clean(link)
+}
+
+// Remove forgets the links at path and below it.
+func (s *symlinks) Remove(path string) {
+	s.memAccess.Lock()
+	defer s.memAccess.Unlock()
+
+	for real, link := range s.links {
+		if isWithin(link, path) {
+			delete(s.links, real)
+		}
+	}
+}
+
+// Link maps the real path to it's path under the followed link, using the deepest link containing it.
+// paths outside the followed links are returned unchanged.
+func (s *symlinks) Link(path string) string {
+	s.memAccess.RLock()
+	defer s.memAccess.RUnlock()
+
+	return translate(path, s.links)
+}
+
+// Real maps the path under a followed link to it's real path, using the deepest link containing it.
+// paths outside the followed links are returned unchanged.
+func (s *symlinks) Real(path string) string {
+	s.memAccess.RLock()
+	defer s.memAccess.RUnlock()
+
+	reals := make(map[string]string, len(s.links))
+
+	for real, link := range s.links {
+		reals[link] = real
+	}
+
+	return translate(path, reals)
+}
+
+// translate replaces the longest prefix of path found in prefixes with it's value.
+func translate(path string, prefixes map[string]string) string {
+	var from, to string
+
+	for prefix, replacement := range prefixes {
+		if len(prefix) > len(from) && isWithin(path, prefix) {
+			from, to = prefix, replacement
+		}
+	}
+
+	if from == "" {
+		return path
+	}
+
+	return to + strings.TrimPrefix(filepath.Clean(path), from)
+}
+
+// walkedFromRoot reports whether the real directory is under one of the RootPaths and not excluded, in which case
+// it's walked from there and the links to it are not followed. only the links to the directories outside the root
+// paths are mapped to their link path.
+func (c *Configs) walkedFromRoot(real string) bool {
+	for _, root := range c.RootPaths {
+		abs, err := filepath.Abs(root)
+
+		if err != nil {
+			continue
+		}
+
+		// the root paths may be reached through links themselves
+		realRoot, err := filepath.EvalSymlinks(abs)
+
+		if err != nil {
+			continue
+		}
+
+		rel, err := filepath.Rel(realRoot, real)
+
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+
+		return !c.IsExcluded(filepath.Join(abs, rel), true)
+	}
+
+	return false
+}
+
+// isWithin reports whether path is dir or one of it's descendants.
+func isWithin(path, dir string) bool {
+	path, dir = filepath.Clean(path), filepath.Clean(dir)
+
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
@@ -1,227 +1,1255 @@
-package watcher
-
-import (
-	"fmt"
-	"io/fs"
-	"os"
-	"path/filepath"
-	"slices"
-	"strings"
-	"time"
-
-	"github.com/fsnotify/fsnotify"
-	"github.com/huboh/gwatch/internal/pkg/config"
-	"github.com/huboh/gwatch/internal/pkg/utils"
-)
-
-//
-//
-//* Watcher Configs
-//
-//
-
-type Configs struct {
-	// Exts is the list of file extensions to watch for
-	Exts []string
-
-	// Paths is the list of directories and subdirectories we are watching
-	Paths []string
-
-	// Exclude is the list of directories to Exclude from the watch list
-	Exclude []string
-
-	// recursive set the Delay for event handlers execution
-	Delay time.Duration
-
-	// RootDir iis the current working directory
-	RootDir string
-
-	// Recursive enables watching on the subdirectories of the paths in the watch list
-	Recursive bool
-
-	// RootPaths is the list of parent directories to watch from the config
-	RootPaths []string
-}
-
-func NewConfigs(config config.Config) *Configs {
-	var (
-		c = &Configs{
-			Exts:      config.Exts,
-			Paths:     config.Paths,
-			Exclude:   config.Exclude,
-			RootDir:   config.Root,
-			Delay:     config.Delay,
-			Recursive: config.Recursive,
-			RootPaths: config.Paths,
-		}
-
-		// addMatchedDir adds eligible dir to config's paths
-		addMatchedDir fs.WalkDirFunc = func(dir string, dirEnt fs.DirEntry, err error) error {
-			if dirEnt.IsDir() {
-				for _, e := range c.Exclude {
-					pattern := filepath.Join(c.RootDir, e)
-					isDirOrSub, err := filepath.Match(pattern, dir)
-
-					if err != nil {
-						return err
-					}
-
-					if isDirOrSub {
-						return filepath.SkipDir
-					}
-				}
-
-				if !slices.Contains(c.Paths, dir) {
-					c.Paths = append(c.Paths, dir)
-				}
-			}
-
-			return nil
-		}
-	)
-
-	// recursively add eligible pathNames to configs's paths
-	if c.Recursive {
-		for _, p := range c.Paths {
-			if err := filepath.WalkDir(p, addMatchedDir); err != nil {
-				panic(err)
-			}
-		}
-	}
-
-	return c
-}
-
-//
-//
-//* Watcher
-//
-//
-
-type Watcher struct {
-	configs         *Configs
-	watcher         *fsnotify.Watcher
-	eventHandlers   map[EventType][]EventHandler
-	eventErrHandler func(error)
-}
-
-func New(configs *Configs) (*Watcher, error) {
-	var (
-		e error
-
-		// new watcher
-		w = &Watcher{
-			configs:       configs,
-			eventHandlers: make(map[EventType][]EventHandler),
-		}
-	)
-
-	// wrap error incase of error
-	defer func() {
-		if err := recover(); err != nil {
-			if err, isErr := err.(error); isErr {
-				e = fmt.Errorf("error creating watcher: %w", err)
-			}
-		}
-	}()
-
-	if w.watcher, e = fsnotify.NewWatcher(); e != nil {
-		return nil, e
-	}
-
-	if e = w.Watch(w.configs.Paths...); e != nil {
-		return nil, e
-	}
-
-	return w, nil
-}
-
-func (w *Watcher) Close() error {
-	return w.watcher.Close()
-}
-
-func (w *Watcher) Watch(paths ...string) error {
-	for _, p := range paths {
-		if err := w.watcher.Add(p); err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
-func (w *Watcher) Listen(onListen func(configs Configs)) {
-	defer w.watcher.Close()
-
-	if onListen != nil {
-		go onListen(*w.configs)
-	}
-
-	var (
-		event   *Event
-		handler EventHandler
-
-		// execute last handler call after config's delay
-		debouncedHandler = utils.Debounce(w.configs.Delay, func() {
-			if event != nil && handler != nil {
-				go handler(*event)
-			}
-		})
-	)
-
-	for {
-		select {
-		case err, open := <-w.watcher.Errors:
-			if !open {
-				return
-			}
-
-			go w.eventErrHandler(err)
-
-		case evt, open := <-w.watcher.Events:
-			if !open {
-				return
-			}
-
-			var (
-				fsEvent          = NewEvent(EventType(evt.Op), evt.Name)
-				handlers, exists = w.eventHandlers[fsEvent.Type]
-				extension        = strings.TrimPrefix(filepath.Ext(fsEvent.Path), ".")
-			)
-
-			if !exists {
-				continue
-			}
-
-			stat, err := os.Stat(fsEvent.Path)
-
-			if err != nil {
-				go w.eventErrHandler(err)
-				return
-			}
-
-			// ensure it is a file and we're watching the extension
-			//
-			//? instead of call IsDir() directly on the stat, we get the Mode() then check if it's a file.
-			//? doing this we get the correct file mode for the specific `os`, then check if its a regular file.
-			//? because the FileInfo (stat variable) is an interface and the impl might be different depending on the `os` and `filesystem`
-			if stat.Mode().IsRegular() && slices.Contains(w.configs.Exts, extension) {
-				for _, h := range handlers {
-					event = fsEvent
-					handler = h
-
-					debouncedHandler()
-				}
-			}
-		}
-	}
-}
-
-func (w *Watcher) OnError(h func(error)) {
-	w.eventErrHandler = h
-}
-
-func (w *Watcher) OnEvent(eType EventType, handler EventHandler) {
-	// add handler to event handlers list
-	w.eventHandlers[eType] = append(w.eventHandlers[eType], handler)
-}
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/huboh/gwatch/internal/pkg/config"
+	"github.com/huboh/gwatch/internal/pkg/debounce"
+	"github.com/huboh/gwatch/internal/pkg/git"
+	"github.com/huboh/gwatch/internal/pkg/glob"
+	"github.com/huboh/gwatch/internal/pkg/gomod"
+	"github.com/huboh/gwatch/internal/pkg/utils"
+)
+
+//
+//
+//* Watcher Configs
+//
+//
+
+const (
+	// SourceFS builds the watch set by walking the watched paths, filtered by the Exclude patterns & ignore files.
+	SourceFS = "fs"
+
+	// SourceGit builds the watch set from the files tracked in the git index & the untracked files git doesn't ignore.
+	// it's refreshed when the index changes.
+	SourceGit = "git"
+)
+
+type Configs struct {
+	// Exts is the list of file extensions to watch for
+	Exts []string
+
+	// Paths is the list of directories and subdirectories we are watching
+	Paths []string
+
+	// Files is the list of individual files from the config paths, they're watched regardless of the Exts, Include & Exclude
+	Files []string
+
+	// Include is the list of glob patterns of files to watch in addition to Exts
+	Include []string
+
+	// Exclude is the list of glob patterns of directories and files to Exclude from the watch list
+	Exclude []string
+
+	// EditorIgnore is the list of glob patterns of the editors temporary, swap & backup files, excluded before the Exclude patterns
+	EditorIgnore []string
+
+	// IgnoreFiles enables excluding the paths listed in the .gitignore, .ignore & .gwatchignore files
+	IgnoreFiles bool
+
+	// Source is where the watch set is built from, see SourceFS & SourceGit
+	Source string
+
+	// recursive set the Delay for event handlers execution
+	Delay time.Duration
+
+	// Debounce is the event handlers debouncing options, it's wait is the Delay
+	Debounce debounce.Options
+
+	// Backend is the kind of backend the events are received from, see BackendFsnotify, BackendPoll & BackendAuto
+	Backend string
+
+	// PollInterval is the interval in between scans of the polling backend
+	PollInterval time.Duration
+
+	// SkipUnchanged enables dropping the events of files whose content did not change
+	SkipUnchanged bool
+
+	// FingerprintsFile is the file the files content fingerprints are persisted to, it's empty if they're only kept in memory
+	FingerprintsFile string
+
+	// WatchDeps enables only watching the go files of the packages in the build target's dependency closure
+	WatchDeps bool
+
+	// DepsTarget is the package pattern of the build target, relative to the RootDir
+	DepsTarget string
+
+	// WatchLocalModules enables watching the local modules of go.mod's replace directives & the go.work file
+	WatchLocalModules bool
+
+	// LocalModules is the list of the local modules directories being watched
+	LocalModules []string
+
+	// FollowSymlinks enables walking into the symbolic links to directories, watching their real directories
+	FollowSymlinks bool
+
+	// HoldGitOperations enables holding the deliveries to the handlers while a git operation runs in the repository of the RootDir
+	HoldGitOperations bool
+
+	// GitLockTimeout is the time without changes after which an index lock is considered left over by a crashed git process
+	GitLockTimeout time.Duration
+
+	// RecordFile is the file the raw events are recorded to, it's empty if the events are not recorded
+	RecordFile string
+
+	// RecordStart is when the session recorded to RecordFile started, the session is started over if it's zero.
+	// New sets it, so the watcher created again on a config reload appends to the same session
+	RecordStart time.Time
+
+	// ReplayFile is the recorded session replayed instead of watching the disk, it's empty if no session is replayed.
+	// the content of the files is not recorded, so SkipUnchanged is disabled while replaying
+	ReplayFile string
+
+	// RootDir iis the current working directory
+	RootDir string
+
+	// Recursive enables watching on the subdirectories of the paths in the watch list
+	Recursive bool
+
+	// RootPaths is the list of parent directories to watch from the config
+	RootPaths []string
+
+	// includeRules is the compiled Include patterns
+	includeRules glob.Rules
+
+	// excludeRules is the compiled EditorIgnore & Exclude patterns
+	excludeRules glob.Rules
+
+	// ignoreFiles is the rules of the ignore files, it's nil if IgnoreFiles is disabled
+	ignoreFiles *ignoreFiles
+
+	// git is the watch set of the git index, it's nil unless the Source is SourceGit
+	git *gitSource
+
+	// deps is the build target's dependency graph, it's nil if WatchDeps is disabled
+	deps *depsGraph
+
+	// links is the followed symbolic links, it's nil if FollowSymlinks is disabled
+	links *symlinks
+
+	// filesDirs is the list of directories only watched for the individual Files they contain
+	filesDirs []string
+
+	// Warnings is the errors of the optional features the configs were resolved without, like a failed dependency listing
+	Warnings []error
+}
+
+// NewConfigs resolves the watcher configs from the app config.
+// It returns an error if a pattern is invalid, naming the config file, the option & the pattern.
+func NewConfigs(config config.Config) (*Configs, error) {
+	includeRules, err := compileRules("include", config.Include)
+
+	if err != nil {
+		return nil, err
+	}
+
+	editorRules, err := compileRules("editor_ignore", config.EditorIgnore)
+
+	if err != nil {
+		return nil, err
+	}
+
+	excludeRules, err := compileRules("exclude", config.Exclude)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		c = &Configs{
+			Exts:         config.Exts,
+			Include:      config.Include,
+			Exclude:      config.Exclude,
+			EditorIgnore: config.EditorIgnore,
+			IgnoreFiles:  config.IgnoreFiles,
+			Source:       config.Source,
+			RootDir:      config.Root,
+			Delay:        config.Delay,
+			Debounce: debounce.Options{
+				Wait:     config.Delay,
+				Leading:  config.Debounce.Leading,
+				Trailing: config.Debounce.Trailing,
+				MaxWait:  config.Debounce.MaxWait,
+			},
+			Backend:           config.Backend,
+			PollInterval:      config.PollInterval,
+			SkipUnchanged:     config.SkipUnchanged,
+			WatchDeps:         config.WatchDeps,
+			WatchLocalModules: config.WatchLocalModules,
+			DepsTarget:        config.DepsTarget,
+			FollowSymlinks:    config.FollowSymlinks,
+			HoldGitOperations: config.HoldGitOperations,
+			GitLockTimeout:    config.GitLockTimeout,
+			Recursive:         config.Recursive,
+			RootPaths:         config.Paths,
+			includeRules:      includeRules,
+			excludeRules:      slices.Concat(editorRules, excludeRules),
+		}
+
+		// addMatchedDir adds eligible dir to config's paths
+		addMatchedDir = func(dir string) {
+			if !slices.Contains(c.Paths, dir) {
+				c.Paths = append(c.Paths, dir)
+			}
+		}
+	)
+
+	for _, p := range config.Paths {
+		if stat, err := os.Stat(p); err == nil && stat.Mode().IsRegular() {
+			c.Files = append(c.Files, utils.Must(filepath.Abs(p)))
+			continue
+		}
+
+		addMatchedDir(p)
+	}
+
+	if c.SkipUnchanged && config.PersistFingerprints {
+		c.FingerprintsFile = filepath.Join(config.StateDir(), "fingerprints.json")
+	}
+
+	if c.IgnoreFiles {
+		c.ignoreFiles = newIgnoreFiles(utils.Must(filepath.Abs(c.RootDir)), ignoreFileNames)
+	}
+
+	switch c.Source {
+	case SourceGit:
+		git, err := newGitSource(c.RootDir)
+
+		if err != nil {
+			return nil, configErr("source", err)
+		}
+
+		c.git = git
+
+	case SourceFS, "":
+
+	default:
+		return nil, configErr("source", fmt.Errorf("unknown watch source %q, expected %s or %s", c.Source, SourceFS, SourceGit))
+	}
+
+	if c.FollowSymlinks {
+		c.links = newSymlinks()
+	}
+
+	// only watch the directories of the dependency closure, including the local replacement modules outside the root directory
+	if c.WatchDeps {
+		deps, err := newDepsGraph(utils.Must(filepath.Abs(c.RootDir)), c.DepsTarget)
+
+		// watch all the paths rather than none
+		if err != nil {
+			c.Warnings = append(c.Warnings, fmt.Errorf("watch_deps: %w, watching all the go files", err))
+		} else {
+			c.deps = deps
+			c.Paths = nil
+
+			for _, dir := range c.deps.WatchDirs() {
+				if !c.IsExcluded(dir, true) {
+					addMatchedDir(dir)
+				}
+			}
+		}
+	}
+
+	// watch the local modules developed along side the app
+	if c.WatchLocalModules {
+		modules, err := gomod.LocalModules(c.RootDir)
+
+		if err != nil {
+			c.Warnings = append(c.Warnings, fmt.Errorf("watch_local_modules: %w", err))
+		}
+
+		// the go.work file usually sits above the root directory, it's watched to read the modules again.
+		// the dependency graph doesn't watch the root paths, only the directories the app is built from
+		if work := gomod.WorkFile(c.RootDir); work != "" && (c.deps != nil || !c.underRootPaths(work)) && !slices.Contains(c.Files, work) {
+			c.Files = append(c.Files, work)
+		}
+
+		c.LocalModules = modules
+
+		// the dependency graph only watches the directories of the local modules the app is built from
+		if c.deps == nil {
+			for _, dir := range c.LocalModules {
+				addMatchedDir(dir)
+			}
+		}
+	}
+
+	// recursively add eligible pathNames to configs's paths
+	if c.Recursive && c.deps == nil {
+		for _, p := range c.Paths {
+			if err := c.walkDirs(p, addMatchedDir); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// watch the individual files from their directory, as editors replace the files they save
+	for _, file := range c.Files {
+		if dir := filepath.Dir(file); !slices.Contains(c.Paths, dir) {
+			c.Paths = append(c.Paths, dir)
+			c.filesDirs = append(c.filesDirs, dir)
+		}
+	}
+
+	return c, nil
+}
+
+// compileRules compiles the patterns of the config option, the error names the config file & the option.
+func compileRules(option string, patterns []string) (glob.Rules, error) {
+	rules, err := glob.Compile("", option, patterns)
+
+	if err != nil {
+		return nil, configErr(option, err)
+	}
+
+	return rules, nil
+}
+
+// configErr returns the error of the config option, naming the config file & the option.
+func configErr(option string, err error) error {
+	return fmt.Errorf("%s: %s: %w", config.ConfigPath, option, err)
+}
+
+// walk walks the directory tree rooted at root like filepath.WalkDir.
+//
+// If FollowSymlinks is enabled, the symbolic links to directories are walked into as directories, once per real directory,
+// which breaks the link cycles. fn receives the paths under the links, while their real directories are recorded to be watched.
+func (c *Configs) walk(root string, fn fs.WalkDirFunc) error {
+	if c.links == nil {
+		return filepath.WalkDir(root, fn)
+	}
+
+	var (
+		stopped bool
+		visited = make(map[string]bool)
+		walkDir func(link, real string) error
+	)
+
+	walkDir = func(link, real string) error {
+		return filepath.WalkDir(real, func(path string, dirEnt fs.DirEntry, err error) error {
+			name := link + strings.TrimPrefix(path, real)
+
+			switch {
+			case err != nil:
+
+			case dirEnt.IsDir():
+				// the directory was already walked, from a link or it's a link cycle
+				if visited[path] {
+					return filepath.SkipDir
+				}
+
+				visited[path] = true
+
+			case dirEnt.Type()&fs.ModeSymlink != 0:
+				target, err := filepath.EvalSymlinks(path)
+
+				// dangling links are walked as files
+				if err != nil {
+					break
+				}
+
+				if stat, err := os.Stat(target); err != nil || !stat.IsDir() {
+					break
+				}
+
+				// the directory is walked from it's real path, where it's events are reported
+				if visited[target] || c.walkedFromRoot(target) {
+					return nil
+				}
+
+				c.links.Add(target, name)
+
+				if err := walkDir(name, target); err != nil {
+					return err
+				}
+
+				if stopped {
+					return filepath.SkipAll
+				}
+
+				return nil
+			}
+
+			err = fn(name, dirEnt, err)
+			stopped = stopped || err == filepath.SkipAll
+
+			return err
+		})
+	}
+
+	real, err := filepath.EvalSymlinks(root)
+
+	if err != nil {
+		return fn(root, nil, err)
+	}
+
+	if real != filepath.Clean(root) {
+		c.links.Add(real, root)
+	}
+
+	return walkDir(filepath.Clean(root), real)
+}
+
+// prioritized returns the paths to watch from the most important to the least: the directories of the build target's
+// dependency closure if WatchDeps is enabled, then the directories closest to the root paths.
+func (c *Configs) prioritized() []string {
+	priority := func(dir string) int {
+		depth := strings.Count(c.relPath(dir), "/")
+
+		if c.deps != nil && !c.deps.ContainsDir(dir) {
+			depth += len(c.Paths)
+		}
+
+		return depth
+	}
+
+	paths := slices.Clone(c.Paths)
+
+	slices.SortStableFunc(paths, func(a, b string) int {
+		return priority(a) - priority(b)
+	})
+
+	return paths
+}
+
+// realPath returns the real path of path if it's under a followed symbolic link.
+func (c *Configs) realPath(path string) string {
+	if c.links == nil {
+		return path
+	}
+
+	return c.links.Real(path)
+}
+
+// linkPath returns the path under the followed symbolic link of the real path.
+func (c *Configs) linkPath(path string) string {
+	if c.links == nil {
+		return path
+	}
+
+	return c.links.Link(path)
+}
+
+// walkDirs walks the directory tree rooted at root, calling fn for root and each of it's subdirectories
+// that is not excluded. excluded directories are skipped along with their content.
+func (c *Configs) walkDirs(root string, fn func(dir string)) error {
+	return c.walk(root, func(dir string, dirEnt fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if dirEnt.IsDir() {
+			if c.IsExcluded(dir, true) {
+				return filepath.SkipDir
+			}
+
+			fn(dir)
+		}
+
+		return nil
+	})
+}
+
+// IsExcluded reports whether path, or one of it's parent directories, is matched by the Exclude patterns,
+// ignored by the ignore files if IgnoreFiles is enabled, or ignored by git & untracked if the Source is SourceGit.
+func (c *Configs) IsExcluded(path string, isDir bool) bool {
+	excluded, _ := c.excludedBy(path, isDir)
+
+	return excluded
+}
+
+// excludedBy reports whether the path is excluded, along with the rule that excluded it.
+func (c *Configs) excludedBy(path string, isDir bool) (bool, *glob.Rule) {
+	rel := c.relPath(path)
+
+	if excluded, r := c.excludeRules.Excludes(rel, isDir); excluded {
+		return true, r
+	}
+
+	if c.ignoreFiles != nil {
+		if ignored, r := c.ignoreFiles.Excludes(rel, isDir); ignored {
+			return true, r
+		}
+	}
+
+	if c.git != nil {
+		if ignored, r := c.git.Excludes(path, isDir); ignored {
+			return true, r
+		}
+	}
+
+	return false, nil
+}
+
+// IsWatched reports whether changes to the file at path should trigger the event handlers.
+//
+// the individual Files are always watched, and the other files of their directories never are.
+// if WatchDeps is enabled, go files must also belong to a package in the build target's dependency closure,
+// and the other files must be in one of it's directories, like the embedded files.
+// the decision is made by explainFile, so Explain gives it's reason.
+func (c *Configs) IsWatched(path string) bool {
+	return c.explainFile(path).Watched
+}
+
+// underRootPaths reports whether path is one of the RootPaths or under one of them.
+func (c *Configs) underRootPaths(path string) bool {
+	return slices.ContainsFunc(c.RootPaths, func(root string) bool {
+		abs, err := filepath.Abs(root)
+
+		return err == nil && isWithin(path, abs)
+	})
+}
+
+// inFilesDir reports whether path is in a directory only watched for the individual Files it contains.
+func (c *Configs) inFilesDir(path string) bool {
+	abs, err := filepath.Abs(path)
+
+	return err == nil && slices.Contains(c.filesDirs, filepath.Dir(abs))
+}
+
+// containsWatchedFiles reports whether the directory tree rooted at dir contains watched files.
+func (c *Configs) containsWatchedFiles(dir string) bool {
+	found := false
+
+	c.walk(dir, func(path string, dirEnt fs.DirEntry, err error) error {
+		switch {
+		case err != nil:
+			return nil
+
+		case dirEnt.IsDir():
+			if c.IsExcluded(path, true) {
+				return filepath.SkipDir
+			}
+
+		case dirEnt.Type().IsRegular() && c.IsWatched(path):
+			found = true
+			return filepath.SkipAll
+		}
+
+		return nil
+	})
+
+	return found
+}
+
+// relPath returns the slash separated path relative to the root directory,
+// which is what the Include and Exclude patterns are matched against.
+func (c *Configs) relPath(path string) string {
+	root, err := filepath.Abs(c.RootDir)
+
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+
+	abs, err := filepath.Abs(path)
+
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+
+	rel, err := filepath.Rel(root, abs)
+
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+
+	return filepath.ToSlash(rel)
+}
+
+//
+//
+//* Watcher
+//
+//
+
+type Watcher struct {
+	configs         *Configs
+	backend         Backend
+	fingerprints    *Fingerprints
+	events          chan Event
+	errors          chan error
+	limitErr        *WatchLimitError
+	subscriptions   []*subscription
+	eventErrHandler func(error)
+	warnHandler     func(error)
+	traceHandler    func(Event, string)
+	paused          atomic.Bool
+
+	// gitDir is the git directory watched for git operations, it's empty if HoldGitOperations is disabled or there's no repository
+	gitDir string
+
+	// gitRunning reports whether a git operation is running, see syncGitOperation
+	gitRunning atomic.Bool
+
+	// gitHandler is called when a git operation starts and ends
+	gitHandler func(running bool)
+
+	// lastChange is the time the last event was received from the backend, an index lock isn't stale while the files keep changing
+	lastChange atomic.Int64
+
+	// stat returns the state of the path, from the disk or from the replayed session
+	stat func(string) (fs.FileInfo, error)
+
+	// replay is the backend replaying a recorded session, it's nil unless ReplayFile is set
+	replay *replayBackend
+
+	// depsRefresh debounces the refreshes of the dependency graph, it's nil if WatchDeps is disabled
+	depsRefresh *debounce.Debouncer
+
+	// depsUpdates is the channel the refreshes of the dependency graph are sent to Run on
+	depsUpdates chan depsUpdate
+
+	// depsRequests is the number of refreshes of the dependency graph requested by Run, see depsUpdate.seq
+	depsRequests atomic.Int64
+
+	// depsMemAccess serializes the refreshes of the dependency graph
+	depsMemAccess *sync.Mutex
+
+	// done is closed once Run returns
+	done chan struct{}
+}
+
+func New(configs *Configs) (*Watcher, error) {
+	var (
+		e error
+
+		// new watcher
+		w = &Watcher{
+			configs: configs,
+			events:  make(chan Event),
+			errors:  make(chan error),
+			stat:    os.Stat,
+			done:    make(chan struct{}),
+		}
+	)
+
+	// wrap error incase of error
+	defer func() {
+		if err := recover(); err != nil {
+			if err, isErr := err.(error); isErr {
+				e = fmt.Errorf("error creating watcher: %w", err)
+			}
+		}
+	}()
+
+	root, e := filepath.Abs(w.configs.RootDir)
+
+	if e != nil {
+		return nil, e
+	}
+
+	if w.configs.ReplayFile != "" {
+		replay, err := newReplayBackend(root, w.configs.ReplayFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		w.backend, w.stat, w.replay = replay, replay.Stat, replay
+	} else if w.backend, e = newBackend(w.configs.Backend, w.configs.PollInterval); e != nil {
+		return nil, e
+	}
+
+	// closeOnErr releases the os watches of the backend when the watcher can't be created
+	closeOnErr := func(err error) (*Watcher, error) {
+		w.backend.Close()
+		return nil, err
+	}
+
+	// watch the highest priority paths first, so they get the os events if the limit of watches is reached
+	paths := w.configs.prioritized()
+
+	if e = w.Watch(paths...); e != nil {
+		var limitErr *WatchLimitError
+
+		if errors.As(e, &limitErr) {
+			limitErr.Needed = len(paths)
+		}
+
+		return closeOnErr(e)
+	}
+
+	// the auto backend polls the paths it could not watch after reaching the limit
+	if auto, isAuto := w.backend.(*autoBackend); isAuto {
+		if w.limitErr = auto.LimitErr(); w.limitErr != nil {
+			w.limitErr.Needed = len(paths)
+		}
+	}
+
+	// watch the git directory for the markers of git operations & the index changes, it's usually excluded so it's not in the paths
+	if w.configs.HoldGitOperations || w.configs.git != nil {
+		if _, w.gitDir = git.FindRepo(root); w.gitDir != "" {
+			if e = w.backend.Add(w.gitDir); e != nil {
+				return closeOnErr(e)
+			}
+		}
+	}
+
+	if w.configs.HoldGitOperations && w.gitDir != "" {
+		w.syncGitOperation()
+	}
+
+	// record the raw events, once the paths are watched
+	if w.configs.RecordFile != "" {
+		record, err := newRecordBackend(w.backend, root, w.configs.RecordFile, w.configs.RecordStart)
+
+		if err != nil {
+			return closeOnErr(err)
+		}
+
+		w.backend, w.configs.RecordStart = record, record.start
+	}
+
+	if w.configs.deps != nil {
+		w.depsUpdates = make(chan depsUpdate)
+		w.depsMemAccess = new(sync.Mutex)
+		w.depsRefresh = debounce.New(w.refreshDeps, debounce.Options{Wait: depsRefreshDelay, Trailing: true, MaxWait: depsRefreshMaxWait})
+	}
+
+	if w.configs.SkipUnchanged && w.configs.ReplayFile == "" {
+		w.fingerprints = newFingerprints(w.configs.FingerprintsFile)
+		w.primeFingerprints()
+	}
+
+	return w, nil
+}
+
+// primeFingerprints records the content fingerprint of the watched files in the watched directories.
+func (w *Watcher) primeFingerprints() {
+	for _, dir := range w.configs.Paths {
+		entries, err := os.ReadDir(dir)
+
+		if err != nil {
+			continue
+		}
+
+		for _, e := range entries {
+			path := filepath.Join(dir, e.Name())
+
+			if !e.Type().IsRegular() || !w.configs.IsWatched(path) {
+				continue
+			}
+
+			// files that can't be read are reported as changed on their next event
+			if stat, err := e.Info(); err == nil {
+				w.fingerprints.Prime(path, stat)
+			}
+		}
+	}
+}
+
+// LimitErr returns the error of the os limit of watches if it was reached while watching the paths,
+// in which case the paths watched after are polled. It's nil if the limit was not reached.
+func (w *Watcher) LimitErr() *WatchLimitError {
+	return w.limitErr
+}
+
+// Fingerprints returns the watched files content fingerprints, it's nil if SkipUnchanged is disabled.
+func (w *Watcher) Fingerprints() *Fingerprints {
+	return w.fingerprints
+}
+
+func (w *Watcher) Close() error {
+	return w.backend.Close()
+}
+
+func (w *Watcher) Watch(paths ...string) error {
+	for _, p := range paths {
+		if err := w.backend.Add(w.configs.realPath(p)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Unwatch removes the paths and their watched subdirectories from the watch list.
+func (w *Watcher) Unwatch(paths ...string) error {
+	for _, p := range paths {
+		p = filepath.Clean(p)
+
+		for _, watched := range w.backend.WatchList() {
+			if !isWithin(w.configs.linkPath(watched), p) {
+				continue
+			}
+
+			// the watch is automatically removed when a watched directory is deleted
+			if err := w.backend.Remove(watched); err != nil && !errors.Is(err, ErrNotWatched) {
+				return err
+			}
+		}
+
+		// the removed links may be replaced by other directories
+		if w.configs.links != nil {
+			w.configs.links.Remove(p)
+		}
+	}
+
+	return nil
+}
+
+// syncWatchList keeps the watch list in sync with the directories created, removed or renamed after we started watching.
+func (w *Watcher) syncWatchList(e Event) error {
+	switch {
+	case e.Type.Has(CreateEvent):
+		stat, err := w.stat(e.Path)
+
+		// the directory might have been removed already
+		if err != nil || !stat.IsDir() || w.configs.IsExcluded(e.Path, true) || w.configs.inFilesDir(e.Path) {
+			return nil
+		}
+
+		// the dependency graph only watches the directories the app is built from, and the parents of the missing packages
+		deps := w.configs.deps
+
+		if deps == nil && !w.configs.Recursive {
+			return nil
+		}
+
+		// the replayed session delivers the events of it's subdirectories, whatever the watch list
+		if w.replay != nil {
+			if deps != nil && !deps.WatchesDir(e.Path) {
+				return nil
+			}
+
+			return w.Watch(e.Path)
+		}
+
+		var dirs []string
+
+		addDir := func(dir string) {
+			if deps == nil || deps.WatchesDir(dir) {
+				dirs = append(dirs, dir)
+			}
+		}
+
+		// the directories might be removed while they're walked & watched, like the temporary directories of builds & tests
+		if err := w.configs.walkDirs(e.Path, addDir); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		for _, dir := range dirs {
+			if err := w.Watch(dir); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+
+		return nil
+
+	case e.Type.Has(RemoveEvent), e.Type.Has(RenameEvent):
+		// the renamed directory is watched again when it's create event is received from it's new parent directory
+		return w.Unwatch(e.Path)
+	}
+
+	return nil
+}
+
+// Events returns the channel the watched files events are sent to by Run, as they're received.
+// the events are neither debounced nor checked for content changes, see OnEvent & OnBatch for that.
+//
+// It's closed once Run returns.
+func (w *Watcher) Events() <-chan Event {
+	return w.events
+}
+
+// Errors returns the channel the watcher errors are sent to by Run, it's closed once Run returns.
+func (w *Watcher) Errors() <-chan error {
+	return w.errors
+}
+
+// Run receives the backend events until the context is canceled or the watcher is closed,
+// sending the events of the watched files on the Events channel & the errors on the Errors channel.
+//
+// Both channels must be read, Run blocks until they are. Run closes the watcher & both channels when it returns,
+// it must be called once. It returns the context error if it's canceled, and nil if the watcher is closed.
+func (w *Watcher) Run(ctx context.Context) error {
+	defer close(w.events)
+	defer close(w.errors)
+	defer w.backend.Close()
+	defer close(w.done)
+
+	saves := newAtomicSaves()
+	defer saves.Stop()
+
+	if w.depsRefresh != nil {
+		defer w.depsRefresh.Stop()
+	}
+
+	// depsHeld is the events held until the dependency graph is refreshed, so they're decided against the new closure
+	var depsHeld []depsHeldEvent
+
+	// gitCheck fires while a git operation runs, so a stale index lock left by a crashed git process is eventually ignored
+	var gitCheck <-chan time.Time
+
+	if w.gitRunning.Load() {
+		gitCheck = time.After(w.gitLockTimeout())
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case <-gitCheck:
+			gitCheck = nil
+
+			if w.syncGitOperation() {
+				gitCheck = time.After(w.gitLockTimeout())
+			}
+
+		case err, open := <-w.backend.Errors():
+			if !open {
+				return nil
+			}
+
+			if !w.sendError(ctx, err) {
+				return ctx.Err()
+			}
+
+		case evt := <-saves.Expired():
+			if !w.forward(ctx, evt) {
+				return ctx.Err()
+			}
+
+		case update := <-w.depsUpdates:
+			if err := w.applyDepsUpdate(update); err != nil && !w.sendError(ctx, err) {
+				return ctx.Err()
+			}
+
+			// forward the events held until this refresh, in order
+			for len(depsHeld) > 0 && depsHeld[0].seq <= update.seq {
+				evt := depsHeld[0].evt
+				depsHeld = depsHeld[1:]
+
+				if !w.forward(ctx, evt) {
+					return ctx.Err()
+				}
+			}
+
+		case evt, open := <-w.backend.Events():
+			if !open {
+				return nil
+			}
+
+			w.lastChange.Store(time.Now().UnixNano())
+
+			// report the events under the followed symbolic links
+			evt.Path = w.configs.linkPath(evt.Path)
+
+			// the events of the git directory only refresh the git source, and start & end the git operations
+			if w.isGitEvent(evt) {
+				if err := w.refreshGitSource(evt); err != nil && !w.sendError(ctx, err) {
+					return ctx.Err()
+				}
+
+				if w.configs.HoldGitOperations {
+					gitCheck = nil
+
+					if w.syncGitOperation() {
+						gitCheck = time.After(w.gitLockTimeout())
+					}
+				}
+
+				w.trace(evt, "dropped, it's in the git directory")
+				continue
+			}
+
+			// hold the removals of watched files, they're replaced by a write if the file is saved atomically
+			if w.isAtomicSaveRemoval(evt) {
+				w.trace(evt, "held, waiting for the file to be created again by an atomic save")
+				saves.Hold(evt)
+				continue
+			}
+
+			if held, ok := saves.Release(evt); ok {
+				stat, err := w.stat(evt.Path)
+
+				// the file was saved atomically, otherwise the removal is dispatched first
+				if evt.Type.Has(CreateEvent) && err == nil && stat.Mode().IsRegular() {
+					w.trace(evt, "atomic save, replaced along with the held removal by a write event")
+					evt = *NewEvent(WriteEvent, evt.Path)
+				} else if !w.forward(ctx, held) {
+					return ctx.Err()
+				}
+			}
+
+			// the events following the held ones are held as well, so they're forwarded in order
+			if needsRefresh := w.needsDepsRefresh(evt); needsRefresh || len(depsHeld) > 0 {
+				seq := w.depsRequests.Load()
+
+				if needsRefresh {
+					seq = w.depsRequests.Add(1)
+					w.depsRefresh.Trigger()
+				}
+
+				w.trace(evt, "held, waiting for the refresh of the dependency graph")
+				depsHeld = append(depsHeld, depsHeldEvent{evt: evt, seq: seq})
+				continue
+			}
+
+			if !w.forward(ctx, evt) {
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// forward processes the event and sends it on the Events channel if it should be dispatched,
+// it reports false if the context was canceled first.
+func (w *Watcher) forward(ctx context.Context, e Event) bool {
+	if !w.process(ctx, e) {
+		if w.traceHandler != nil {
+			w.trace(e, "dropped, "+w.dropReason(e))
+		}
+
+		return true
+	}
+
+	w.trace(e, "dispatched")
+
+	select {
+	case w.events <- e:
+		return true
+
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// process updates the watcher state from the event, and reports whether it should be sent on the Events channel.
+func (w *Watcher) process(ctx context.Context, e Event) bool {
+	// reload the rules of changed ignore files
+	if w.configs.ignoreFiles != nil {
+		w.configs.ignoreFiles.Forget(w.configs.relPath(e.Path))
+	}
+
+	if w.configs.git != nil {
+		w.configs.git.Forget(e.Path)
+	}
+
+	if err := w.refreshLocalModules(e); err != nil {
+		w.sendError(ctx, err)
+	}
+
+	// decide before syncing the watch list, as removed directories are only known from the watch list
+	dispatch, err := w.shouldDispatch(e)
+
+	if err != nil {
+		w.sendError(ctx, err)
+	}
+
+	if err := w.syncWatchList(e); err != nil {
+		w.sendError(ctx, err)
+	}
+
+	return dispatch
+}
+
+// sendError sends the error on the Errors channel, it reports false if the context was canceled first.
+func (w *Watcher) sendError(ctx context.Context, err error) bool {
+	select {
+	case w.errors <- err:
+		return true
+
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Listen runs the watcher until it's closed, delivering the events to the handlers added with OnEvent & OnBatch,
+// and the errors to the handler set with OnError.
+func (w *Watcher) Listen(onListen func(configs Configs)) {
+	go w.Run(context.Background())
+
+	if onListen != nil {
+		go onListen(*w.configs)
+	}
+
+	// cancel the pending deliveries once we stop listening
+	defer func() {
+		for _, sub := range w.subscriptions {
+			sub.stop()
+		}
+	}()
+
+	for {
+		select {
+		case err, open := <-w.errors:
+			if !open {
+				return
+			}
+
+			if w.eventErrHandler != nil {
+				go w.eventErrHandler(err)
+			}
+
+		case evt, open := <-w.events:
+			if !open {
+				return
+			}
+
+			handled := false
+
+			for _, sub := range w.subscriptions {
+				handled = sub.add(evt) || handled
+			}
+
+			if !handled {
+				w.trace(evt, fmt.Sprintf("no handler receives %s events", evt.Type))
+			}
+		}
+	}
+}
+
+// shouldDispatch reports whether the event should be dispatched to the event handlers, depending on it's type:
+//
+//   - WriteEvent: the path is an existing, watched file.
+//   - CreateEvent: the path is an existing, watched file or a new directory containing watched files.
+//   - RemoveEvent & RenameEvent: the path was a watched file or directory. since it no longer exists, files are matched by name only.
+//   - ChmodEvent: never dispatched.
+//
+// a path removed before it's write or create event is received is silently dropped.
+// the content of written and created files is checked later by contentChanged, once the writes settled.
+func (w *Watcher) shouldDispatch(e Event) (bool, error) {
+	switch {
+	case e.Type.Has(RemoveEvent), e.Type.Has(RenameEvent):
+		if w.fingerprints != nil {
+			w.fingerprints.Forget(e.Path)
+		}
+
+		return w.isWatchedDir(e.Path) || w.configs.IsWatched(e.Path), nil
+
+	case e.Type.Has(WriteEvent), e.Type.Has(CreateEvent):
+		stat, err := w.stat(e.Path)
+
+		if err != nil {
+			if os.IsNotExist(err) {
+				return false, nil
+			}
+
+			return false, err
+		}
+
+		// ensure it is a file and it matches our include & exclude patterns
+		//
+		//? instead of call IsDir() directly on the stat, we get the Mode() then check if it's a file.
+		//? doing this we get the correct file mode for the specific `os`, then check if its a regular file.
+		//? because the FileInfo (stat variable) is an interface and the impl might be different depending on the `os` and `filesystem`
+		if stat.Mode().IsRegular() {
+			return w.configs.IsWatched(e.Path), nil
+		}
+
+		if stat.IsDir() && e.Type.Has(CreateEvent) {
+			return !w.configs.inFilesDir(e.Path) && w.containsWatchedFiles(e.Path), nil
+		}
+	}
+
+	return false, nil
+}
+
+// containsWatchedFiles reports whether the directory tree rooted at dir contains watched files,
+// from the replayed session if any.
+func (w *Watcher) containsWatchedFiles(dir string) bool {
+	if w.replay != nil {
+		return w.replay.ContainsFiles(dir, w.configs.IsWatched)
+	}
+
+	return w.configs.containsWatchedFiles(dir)
+}
+
+// isWatchedDir reports whether the directory at path is in the watch list.
+func (w *Watcher) isWatchedDir(path string) bool {
+	return slices.Contains(w.backend.WatchList(), filepath.Clean(w.configs.realPath(path)))
+}
+
+func (w *Watcher) OnError(h func(error)) {
+	w.eventErrHandler = h
+}
+
+// OnWarning sets a handler receiving the errors the watcher keeps going after, like a malformed go.mod file.
+// it must be set before calling Run or Listen.
+func (w *Watcher) OnWarning(h func(error)) {
+	w.warnHandler = h
+}
+
+// warn sends the error to the warning handler, if any.
+func (w *Watcher) warn(err error) {
+	if w.warnHandler != nil {
+		w.warnHandler(err)
+	}
+}
+
+// OnTrace sets a handler receiving every event from the backend, along with the decision made for it.
+// it's called synchronously, in the order the events are received, and must be set before calling Run or Listen.
+func (w *Watcher) OnTrace(h func(e Event, decision string)) {
+	w.traceHandler = h
+}
+
+// Pause stops delivering the events to the handlers added with OnEvent & OnBatch, they're collected until Resume is called.
+// the Events channel is not paused.
+func (w *Watcher) Pause() {
+	if w.paused.Swap(true) {
+		return
+	}
+
+	for _, sub := range w.subscriptions {
+		sub.pause()
+	}
+}
+
+// Resume delivers the events collected while paused at once to each handler, if any of the files changed,
+// then delivers the next events as usual.
+func (w *Watcher) Resume() {
+	if !w.paused.Swap(false) {
+		return
+	}
+
+	for _, sub := range w.subscriptions {
+		sub.resume()
+	}
+}
+
+// Paused reports whether the deliveries to the handlers are paused.
+func (w *Watcher) Paused() bool {
+	return w.paused.Load()
+}
+
+// OnEvent adds a handler receiving the last event of the given type, once the events are debounced.
+//
+// each handler is debounced on it's own, handlers must be added before calling Listen.
+func (w *Watcher) OnEvent(eType EventType, handler EventHandler) {
+	w.subscribe(newSubscription(eType, nil, handler, w.configs.Debounce, w.fingerprints))
+}
+
+// OnBatch adds a handler receiving all the events received in between debounced calls, as a de-duplicated batch.
+//
+// each handler is debounced on it's own, handlers must be added before calling Listen.
+func (w *Watcher) OnBatch(handler BatchHandler) {
+	w.subscribe(newSubscription(allEvents, handler, nil, w.configs.Debounce, w.fingerprints))
+}
+
+// subscribe adds the subscription, paused if the watcher is, and held if a git operation is running.
+func (w *Watcher) subscribe(sub *subscription) {
+	if w.paused.Load() {
+		sub.pause()
+	}
+
+	if w.gitRunning.Load() {
+		sub.hold()
+	}
+
+	sub.trace = w.trace
+	sub.stat = w.stat
+	w.subscriptions = append(w.subscriptions, sub)
+}
@@ -0,0 +1,1750 @@
+package watcher_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/huboh/gwatch/internal/pkg/config"
+	"github.com/huboh/gwatch/internal/pkg/watcher"
+)
+
+// writeTree creates the files in the root directory.
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// newTestConfig returns the default config rooted at the root directory.
+func newTestConfig(root string) config.Config {
+	cfg := *config.Default()
+	cfg.Root = root
+	cfg.Paths = []string{root}
+
+	return cfg
+}
+
+// newConfigs resolves the watcher configs of the config, failing the test if they're invalid.
+func newConfigs(t *testing.T, cfg config.Config) *watcher.Configs {
+	t.Helper()
+
+	configs, err := watcher.NewConfigs(cfg)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return configs
+}
+
+func TestIgnoreFiles(t *testing.T) {
+	root := t.TempDir()
+
+	writeTree(t, root, map[string]string{
+		".gitignore":              "/dist\n*.log\ncache/\n",
+		"main.go":                 "",
+		"dist/app.go":             "",
+		"web/.ignore":             "*.go\n!keep.go\n",
+		"web/keep.go":             "",
+		"web/drop.go":             "",
+		"web/cache/file.go":       "",
+		"web/dist/file.html":      "",
+		"pkg/.gwatchignore":       "gen/",
+		"pkg/gen/models.go":       "",
+		"pkg/models.go":           "",
+		".git/info/exclude":       "secret.go\n",
+		"pkg/secret.go":           "",
+		"internal/debug.log/a.go": "",
+	})
+
+	cfg := newTestConfig(root)
+	cfg.IgnoreFiles = true
+
+	configs := newConfigs(t, cfg)
+
+	testData := map[string]bool{
+		"main.go":                 true,
+		"dist/app.go":             false,
+		"web/keep.go":             true,
+		"web/drop.go":             false,
+		"web/cache/file.go":       false,
+		"web/dist/file.html":      true,
+		"pkg/gen/models.go":       false,
+		"pkg/models.go":           true,
+		"pkg/secret.go":           false,
+		"internal/debug.log/a.go": false,
+	}
+
+	for name, watched := range testData {
+		if result := configs.IsWatched(filepath.Join(root, filepath.FromSlash(name))); result != watched {
+			t.Errorf("%s: expected watched %v got %v\n", name, watched, result)
+		}
+	}
+
+	for _, dir := range []string{"dist", "web/cache", "pkg/gen"} {
+		if slices.Contains(configs.Paths, filepath.Join(root, filepath.FromSlash(dir))) {
+			t.Errorf("expected ignored directory %s not to be watched\n", dir)
+		}
+	}
+}
+
+func TestInvalidPatterns(t *testing.T) {
+	testData := map[string]func(cfg *config.Config){
+		"include":       func(cfg *config.Config) { cfg.Include = []string{"**/*.sql", "[a-"} },
+		"exclude":       func(cfg *config.Config) { cfg.Exclude = []string{"/"} },
+		"editor_ignore": func(cfg *config.Config) { cfg.EditorIgnore = []string{"{a,b"} },
+	}
+
+	for option, set := range testData {
+		t.Run(option, func(t *testing.T) {
+			cfg := newTestConfig(t.TempDir())
+			set(&cfg)
+
+			_, err := watcher.NewConfigs(cfg)
+
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+
+			if msg := err.Error(); !strings.Contains(msg, config.ConfigPath) || !strings.Contains(msg, option+": invalid pattern") {
+				t.Errorf("expected the error to name the config file & the %s option, got %q", option, msg)
+			}
+		})
+	}
+}
+
+func TestInvalidSource(t *testing.T) {
+	testData := []struct {
+		source string
+		err    string
+	}{
+		{source: "svn", err: `unknown watch source "svn"`},
+		{source: watcher.SourceGit, err: "git requires a git repository"},
+	}
+
+	for _, td := range testData {
+		cfg := newTestConfig(t.TempDir())
+		cfg.Source = td.source
+
+		if _, err := watcher.NewConfigs(cfg); err == nil || !strings.Contains(err.Error(), "source: "+td.err) {
+			t.Errorf("%s: expected a %q error got %v\n", td.source, td.err, err)
+		}
+	}
+}
+
+func TestWatchCreatedDirs(t *testing.T) {
+	root := t.TempDir()
+	cfg := newTestConfig(root)
+	cfg.Delay = time.Millisecond * 10
+
+	w, err := watcher.New(newConfigs(t, cfg))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := make(chan watcher.Event, 1)
+
+	w.OnError(func(err error) { t.Error(err) })
+	w.OnEvent(watcher.WriteEvent, func(e watcher.Event) { events <- e })
+
+	go w.Listen(nil)
+	defer w.Close()
+
+	dir := filepath.Join(root, "internal", "newpkg")
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// give the watcher time to add the new directories
+	time.Sleep(time.Millisecond * 100)
+
+	writeTree(t, root, map[string]string{"internal/newpkg/pkg.go": "package newpkg"})
+
+	select {
+	case e := <-events:
+		if e.Path != filepath.Join(dir, "pkg.go") {
+			t.Errorf("expected event for %s got %s\n", filepath.Join(dir, "pkg.go"), e.Path)
+		}
+
+	case <-time.After(time.Second):
+		t.Error("expected write event in new directory")
+	}
+}
+
+func TestShortLivedDirs(t *testing.T) {
+	root := t.TempDir()
+	cfg := newTestConfig(root)
+	cfg.Delay = time.Millisecond * 10
+
+	w, err := watcher.New(newConfigs(t, cfg))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := make(chan watcher.Event, 1)
+
+	w.OnError(func(err error) { t.Error(err) })
+	w.OnEvent(watcher.WriteEvent, func(e watcher.Event) {
+		select {
+		case events <- e:
+		default:
+		}
+	})
+
+	go w.Listen(nil)
+	defer w.Close()
+
+	// like the temporary directories of builds & tests, removed while the watcher walks & watches them
+	for i := range 50 {
+		dir := filepath.Join(root, "tmp", fmt.Sprintf("go-build%d", i), "b001")
+
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.RemoveAll(filepath.Join(root, "tmp")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	time.Sleep(time.Millisecond * 100)
+	writeTree(t, root, map[string]string{"main.go": "package main"})
+
+	select {
+	case e := <-events:
+		if e.Path != filepath.Join(root, "main.go") {
+			t.Errorf("expected event for %s got %s\n", filepath.Join(root, "main.go"), e.Path)
+		}
+
+	case <-time.After(time.Second):
+		t.Error("expected the watcher to keep running")
+	}
+}
+
+func TestDispatchRemovedFiles(t *testing.T) {
+	root := t.TempDir()
+	cfg := newTestConfig(root)
+	cfg.Delay = time.Millisecond * 10
+
+	writeTree(t, root, map[string]string{"main.go": "package main", "util.go": "package main"})
+
+	w, err := watcher.New(newConfigs(t, cfg))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := make(chan watcher.Event, 1)
+
+	w.OnError(func(err error) { t.Error(err) })
+	w.OnEvent(watcher.WriteEvent, func(e watcher.Event) { events <- e })
+	w.OnEvent(watcher.RemoveEvent, func(e watcher.Event) { events <- e })
+
+	go w.Listen(nil)
+	defer w.Close()
+
+	expectEvent := func(eType watcher.EventType, path string) {
+		t.Helper()
+
+		select {
+		case e := <-events:
+			if e.Type != eType || e.Path != path {
+				t.Errorf("expected %s event for %s got %s event for %s\n", eType, path, e.Type, e.Path)
+			}
+
+		case <-time.After(time.Second):
+			t.Errorf("expected %s event for %s\n", eType, path)
+		}
+	}
+
+	if err := os.Remove(filepath.Join(root, "util.go")); err != nil {
+		t.Fatal(err)
+	}
+
+	expectEvent(watcher.RemoveEvent, filepath.Join(root, "util.go"))
+
+	// the watcher keeps running after a removed file
+	writeTree(t, root, map[string]string{"main.go": "package main\n"})
+	expectEvent(watcher.WriteEvent, filepath.Join(root, "main.go"))
+}
+
+func TestPollBackend(t *testing.T) {
+	root := t.TempDir()
+	cfg := newTestConfig(root)
+	cfg.Delay = time.Millisecond * 10
+	cfg.Backend = watcher.BackendPoll
+	cfg.PollInterval = time.Millisecond * 10
+
+	writeTree(t, root, map[string]string{"main.go": "package main"})
+
+	w, err := watcher.New(newConfigs(t, cfg))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := make(chan watcher.Event, 1)
+
+	w.OnError(func(err error) { t.Error(err) })
+	w.OnEvent(watcher.WriteEvent, func(e watcher.Event) { events <- e })
+	w.OnEvent(watcher.CreateEvent, func(e watcher.Event) { events <- e })
+
+	go w.Listen(nil)
+	defer w.Close()
+
+	for _, td := range []struct {
+		eType watcher.EventType
+		name  string
+	}{
+		{watcher.WriteEvent, "main.go"},
+		{watcher.CreateEvent, "util.go"},
+	} {
+		writeTree(t, root, map[string]string{td.name: "package main\n\nfunc main() {}\n"})
+
+		select {
+		case e := <-events:
+			if path := filepath.Join(root, filepath.FromSlash(td.name)); e.Path != path {
+				t.Errorf("expected event for %s got %s event for %s\n", path, e.Type, e.Path)
+			}
+
+		case <-time.After(time.Second):
+			t.Errorf("expected %s event for %s\n", td.eType, td.name)
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	root := t.TempDir()
+
+	w, err := watcher.New(newConfigs(t, newTestConfig(root)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	go func() { done <- w.Run(ctx) }()
+
+	writeTree(t, root, map[string]string{"main.go": "package main", "notes.txt": ""})
+
+	select {
+	case e := <-w.Events():
+		if path := filepath.Join(root, "main.go"); e.Path != path {
+			t.Errorf("expected event for %s got %s event for %s\n", path, e.Type, e.Path)
+		}
+
+	case err := <-w.Errors():
+		t.Fatal(err)
+
+	case <-time.After(time.Second):
+		t.Fatal("expected event for main.go")
+	}
+
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v got %v\n", context.Canceled, err)
+	}
+
+	// drain the events received before the cancelation
+	for range w.Events() {
+	}
+
+	if _, open := <-w.Errors(); open {
+		t.Error("expected errors channel to be closed")
+	}
+}
+
+func TestSkipUnchanged(t *testing.T) {
+	root := t.TempDir()
+	cfg := newTestConfig(root)
+	cfg.Delay = time.Millisecond * 10
+	cfg.SkipUnchanged = true
+
+	writeTree(t, root, map[string]string{"main.go": "package main"})
+
+	w, err := watcher.New(newConfigs(t, cfg))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := make(chan watcher.Event, 1)
+
+	w.OnError(func(err error) { t.Error(err) })
+	w.OnEvent(watcher.WriteEvent, func(e watcher.Event) { events <- e })
+
+	go w.Listen(nil)
+	defer w.Close()
+
+	// same content, new modification time
+	writeTree(t, root, map[string]string{"main.go": "package main"})
+
+	select {
+	case e := <-events:
+		t.Errorf("expected no event for unchanged content got %s event for %s\n", e.Type, e.Path)
+
+	case <-time.After(time.Millisecond * 200):
+	}
+
+	writeTree(t, root, map[string]string{"main.go": "package main\n"})
+
+	select {
+	case <-events:
+	case <-time.After(time.Second):
+		t.Error("expected write event for changed content")
+	}
+}
+
+func TestBatch(t *testing.T) {
+	root := t.TempDir()
+	cfg := newTestConfig(root)
+	cfg.Delay = time.Millisecond * 50
+
+	writeTree(t, root, map[string]string{"main.go": "package main"})
+
+	w, err := watcher.New(newConfigs(t, cfg))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batches := make(chan watcher.Batch, 2)
+
+	w.OnError(func(err error) { t.Error(err) })
+	w.OnBatch(func(b watcher.Batch) { batches <- b })
+
+	go w.Listen(nil)
+	defer w.Close()
+
+	writeTree(t, root, map[string]string{
+		"main.go":        "package main\n",
+		"util.go":        "package main",
+		"pkg/pkg.go":     "package pkg",
+		"templates/a.md": "ignored extension",
+	})
+
+	writeTree(t, root, map[string]string{"util.go": "package main\n"})
+
+	select {
+	case b := <-batches:
+		expected := []string{
+			filepath.Join(root, "main.go"),
+			filepath.Join(root, "pkg"),
+			filepath.Join(root, "util.go"),
+		}
+
+		if paths := b.Paths(); !slices.Equal(paths, expected) {
+			t.Errorf("expected batch %v got %v\n", expected, paths)
+		}
+
+	case <-time.After(time.Second):
+		t.Error("expected batch")
+	}
+}
+
+func TestMultipleHandlers(t *testing.T) {
+	root := t.TempDir()
+	cfg := newTestConfig(root)
+	cfg.Delay = time.Millisecond * 10
+
+	writeTree(t, root, map[string]string{"main.go": "package main"})
+
+	w, err := watcher.New(newConfigs(t, cfg))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := make(chan watcher.Event, 2)
+
+	w.OnError(func(err error) { t.Error(err) })
+	w.OnEvent(watcher.WriteEvent, func(e watcher.Event) { events <- e })
+	w.OnEvent(watcher.WriteEvent, func(e watcher.Event) { events <- e })
+
+	go w.Listen(nil)
+	defer w.Close()
+
+	writeTree(t, root, map[string]string{"main.go": "package main\n"})
+
+	// every handler receives the event
+	for i := 0; i < 2; i++ {
+		select {
+		case <-events:
+		case <-time.After(time.Second):
+			t.Fatalf("expected event for handler %d\n", i+1)
+		}
+	}
+}
+
+func TestWatchDeps(t *testing.T) {
+	root := t.TempDir()
+
+	writeTree(t, root, map[string]string{
+		"go.mod":               "module example.com/app\n\ngo 1.22\n",
+		"main.go":              "package main\n\nimport _ \"example.com/app/a\"\n\nfunc main() {}\n",
+		"a/a.go":               "package a\n\nimport _ \"embed\"\n\n//go:embed static/a.tmpl\nvar tmpl string\n",
+		"a/static/a.tmpl":      "",
+		"b/b.go":               "package b\n",
+		"tools/tool.go":        "package main\n\nfunc main() {}\n",
+		"templates/index.tmpl": "",
+	})
+
+	cfg := newTestConfig(root)
+	cfg.WatchDeps = true
+
+	configs := newConfigs(t, cfg)
+
+	testData := map[string]bool{
+		"main.go":              true,
+		"a/a.go":               true,
+		"a/static/a.tmpl":      true,
+		"b/b.go":               false,
+		"tools/tool.go":        false,
+		"templates/index.tmpl": false,
+	}
+
+	for name, watched := range testData {
+		if result := configs.IsWatched(filepath.Join(root, filepath.FromSlash(name))); result != watched {
+			t.Errorf("%s: expected watched %v got %v\n", name, watched, result)
+		}
+	}
+
+	// only the directories of the closure & of their embedded files are watched
+	expected := []string{root, filepath.Join(root, "a"), filepath.Join(root, "a", "static")}
+
+	paths := configs.Prioritized()
+	slices.Sort(paths)
+
+	if !slices.Equal(paths, expected) {
+		t.Errorf("expected the watched directories %v got %v\n", expected, paths)
+	}
+}
+
+func TestWatchDepsRefresh(t *testing.T) {
+	root := t.TempDir()
+
+	writeTree(t, root, map[string]string{
+		"go.mod":  "module example.com/app\n\ngo 1.22\n",
+		"main.go": "package main\n\nimport _ \"example.com/app/a\"\n\nfunc main() {}\n",
+		"a/a.go":  "package a\n",
+		"b/b.go":  "package b\n",
+	})
+
+	cfg := newTestConfig(root)
+	cfg.WatchDeps = true
+	cfg.SkipUnchanged = false
+
+	configs := newConfigs(t, cfg)
+	w, err := watcher.New(configs)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go w.Run(ctx)
+
+	testData := []struct {
+		main    string
+		watched map[string]bool
+	}{
+		{
+			// an added import grows the closure
+			main:    "package main\n\nimport (\n\t_ \"example.com/app/a\"\n\t_ \"example.com/app/b\"\n)\n\nfunc main() {}\n",
+			watched: map[string]bool{"a/a.go": true, "b/b.go": true},
+		},
+		{
+			// a removed import shrinks it
+			main:    "package main\n\nimport _ \"example.com/app/b\"\n\nfunc main() {}\n",
+			watched: map[string]bool{"a/a.go": false, "b/b.go": true},
+		},
+	}
+
+	go func() {
+		for {
+			select {
+			case <-w.Events():
+			case <-w.Errors():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for _, td := range testData {
+		writeTree(t, root, map[string]string{"main.go": td.main})
+
+		for name, watched := range td.watched {
+			path := filepath.Join(root, filepath.FromSlash(name))
+			deadline := time.Now().Add(5 * time.Second)
+
+			for configs.IsWatched(path) != watched && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			if result := configs.IsWatched(path); result != watched {
+				t.Errorf("%s: expected watched %v got %v\n", name, watched, result)
+			}
+		}
+	}
+}
+
+func TestWatchDepsMissingPackage(t *testing.T) {
+	// the missing package is not looked up in the module proxy
+	t.Setenv("GOPROXY", "off")
+
+	root := t.TempDir()
+
+	writeTree(t, root, map[string]string{
+		"go.mod":  "module example.com/app\n\ngo 1.22\n",
+		"main.go": "package main\n\nimport _ \"example.com/app/c/d\"\n\nfunc main() {}\n",
+	})
+
+	cfg := newTestConfig(root)
+	cfg.WatchDeps = true
+	cfg.SkipUnchanged = false
+
+	configs := newConfigs(t, cfg)
+	w, err := watcher.New(configs)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go w.Run(ctx)
+
+	go func() {
+		for err := range w.Errors() {
+			t.Error(err)
+		}
+	}()
+
+	// waitEvent waits for an event of the file at path
+	waitEvent := func(path string) {
+		t.Helper()
+
+		timeout := time.After(5 * time.Second)
+
+		for {
+			select {
+			case evt := <-w.Events():
+				if evt.Path == path {
+					return
+				}
+
+			case <-timeout:
+				t.Fatalf("expected an event for %s\n", path)
+			}
+		}
+	}
+
+	// the package imported by main is created after we started watching
+	writeTree(t, root, map[string]string{"c/d/d.go": "package d\n"})
+	waitEvent(filepath.Join(root, "c"))
+
+	path := filepath.Join(root, "c", "d", "d.go")
+
+	if !configs.IsWatched(path) {
+		t.Errorf("expected %s to be watched once it's package is created\n", path)
+	}
+
+	// it's directory is watched
+	writeTree(t, root, map[string]string{"c/d/d.go": "package d\n\nconst D = 1\n"})
+	waitEvent(path)
+}
+
+func TestWatchDepsFallback(t *testing.T) {
+	root := t.TempDir()
+
+	// go list fails on a malformed go.mod file
+	writeTree(t, root, map[string]string{
+		"go.mod":  "module example.com/app\n\ngo 1.22\nrequire (\n",
+		"main.go": "package main\n",
+		"b/b.go":  "package b\n",
+	})
+
+	cfg := newTestConfig(root)
+	cfg.WatchDeps = true
+	cfg.WatchLocalModules = false
+
+	configs := newConfigs(t, cfg)
+
+	if len(configs.Warnings) != 1 {
+		t.Errorf("expected a warning got %v\n", configs.Warnings)
+	}
+
+	if path := filepath.Join(root, "b/b.go"); !configs.IsWatched(path) {
+		t.Errorf("expected %s to be watched\n", path)
+	}
+}
+
+func TestWatchLocalModules(t *testing.T) {
+	t.Setenv("GOWORK", "")
+
+	root := t.TempDir()
+
+	writeTree(t, root, map[string]string{
+		"app/go.mod":          "module example.com/app\n\ngo 1.22\n\nrequire example.com/shared v0.0.0\n\nreplace example.com/shared => ../shared\n",
+		"app/main.go":         "package main\n\nfunc main() {}\n",
+		"shared/go.mod":       "module example.com/shared\n\ngo 1.22\n",
+		"shared/util/util.go": "package util\n",
+		"go.work":             "go 1.22\n\nuse (\n\t./app\n\t./lib\n)\n",
+		"lib/go.mod":          "module example.com/lib\n\ngo 1.22\n",
+		"lib/bin/tool.go":     "package main\n",
+	})
+
+	app := filepath.Join(root, "app")
+	configs := newConfigs(t, newTestConfig(app))
+
+	testData := map[string]bool{
+		filepath.Join(root, "shared"):      true,
+		filepath.Join(root, "shared/util"): true,
+		filepath.Join(root, "lib"):         true,
+		filepath.Join(root, "lib/bin"):     false,
+	}
+
+	for dir, watched := range testData {
+		if result := slices.Contains(configs.Paths, dir); result != watched {
+			t.Errorf("%s: expected watched %v got %v\n", dir, watched, result)
+		}
+	}
+
+	if modules := []string{filepath.Join(root, "lib"), filepath.Join(root, "shared")}; !slices.Equal(configs.LocalModules, modules) {
+		t.Errorf("expected local modules %v got %v\n", modules, configs.LocalModules)
+	}
+}
+
+func TestRefreshLocalModules(t *testing.T) {
+	t.Setenv("GOWORK", "")
+
+	root := t.TempDir()
+
+	writeTree(t, root, map[string]string{
+		"app/go.mod":          "module example.com/app\n\ngo 1.22\n\nrequire example.com/shared v0.0.0\n\nreplace example.com/shared => ../shared\n",
+		"app/main.go":         "package main\n\nfunc main() {}\n",
+		"shared/go.mod":       "module example.com/shared\n\ngo 1.22\n",
+		"shared/util/util.go": "package util\n",
+		"go.work":             "go 1.22\n\nuse ./app\n",
+		"lib/go.mod":          "module example.com/lib\n\ngo 1.22\n",
+		"lib/lib.go":          "package lib\n",
+	})
+
+	cfg := newTestConfig(filepath.Join(root, "app"))
+	cfg.SkipUnchanged = false
+
+	w, err := watcher.New(newConfigs(t, cfg))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go w.Run(ctx)
+
+	// waitEvent reports whether an event for the file is received before the timeout
+	waitEvent := func(name string, timeout time.Duration) bool {
+		path := filepath.Join(root, filepath.FromSlash(name))
+
+		for deadline := time.After(timeout); ; {
+			select {
+			case e := <-w.Events():
+				if e.Path == path {
+					return true
+				}
+
+			case err := <-w.Errors():
+				t.Fatal(err)
+
+			case <-deadline:
+				return false
+			}
+		}
+	}
+
+	// the go.work file above the root is watched, adding a member watches it
+	writeTree(t, root, map[string]string{"go.work": "go 1.22\n\nuse (\n\t./app\n\t./lib\n)\n"})
+
+	if !waitEvent("go.work", 2*time.Second) {
+		t.Fatal("expected event for go.work")
+	}
+
+	// the write may be reported in several events
+	time.Sleep(200 * time.Millisecond)
+
+	writeTree(t, root, map[string]string{"lib/lib.go": "package lib\n\nconst A = 1\n"})
+
+	if !waitEvent("lib/lib.go", 2*time.Second) {
+		t.Error("expected event for lib/lib.go once lib is a go.work member")
+	}
+
+	// dropping the replace directive unwatches the module & it's subdirectories
+	writeTree(t, root, map[string]string{"shared/util/util.go": "package util\n\nconst A = 1\n"})
+
+	if !waitEvent("shared/util/util.go", 2*time.Second) {
+		t.Fatal("expected event for shared/util/util.go")
+	}
+
+	writeTree(t, root, map[string]string{"app/go.mod": "module example.com/app\n\ngo 1.22\n"})
+	time.Sleep(300 * time.Millisecond)
+	writeTree(t, root, map[string]string{"shared/util/util.go": "package util\n\nconst A = 2\n"})
+
+	if waitEvent("shared/util/util.go", 500*time.Millisecond) {
+		t.Error("expected no event for shared/util/util.go once the replace directive is dropped")
+	}
+
+	// a malformed go.mod file keeps the previous modules
+	writeTree(t, root, map[string]string{"app/go.mod": "module example.com/app\n\nrequire (\n"})
+	time.Sleep(300 * time.Millisecond)
+	writeTree(t, root, map[string]string{"lib/lib.go": "package lib\n\nconst A = 2\n"})
+
+	if !waitEvent("lib/lib.go", 2*time.Second) {
+		t.Error("expected event for lib/lib.go after a malformed go.mod")
+	}
+}
+
+// limitedBackend is a backend failing to watch paths once it watches limit paths, like inotify's `max_user_watches`.
+type limitedBackend struct {
+	limit   int
+	watched []string
+	closed  bool
+	events  chan watcher.Event
+	errors  chan error
+}
+
+func newLimitedBackend(limit int) *limitedBackend {
+	return &limitedBackend{limit: limit, events: make(chan watcher.Event), errors: make(chan error)}
+}
+
+func (b *limitedBackend) Add(path string) error {
+	if len(b.watched) == b.limit {
+		return &watcher.WatchLimitError{Watched: len(b.watched), Limit: b.limit, Err: errors.New("no space left on device")}
+	}
+
+	b.watched = append(b.watched, path)
+
+	return nil
+}
+
+func (b *limitedBackend) Remove(path string) error {
+	i := slices.Index(b.watched, path)
+
+	if i < 0 {
+		return watcher.ErrNotWatched
+	}
+
+	b.watched = slices.Delete(b.watched, i, i+1)
+
+	return nil
+}
+
+func (b *limitedBackend) WatchList() []string          { return slices.Clone(b.watched) }
+func (b *limitedBackend) Events() <-chan watcher.Event { return b.events }
+func (b *limitedBackend) Errors() <-chan error         { return b.errors }
+
+func (b *limitedBackend) Close() error {
+	if !b.closed {
+		b.closed = true
+		close(b.events)
+		close(b.errors)
+	}
+
+	return nil
+}
+
+func TestWatchLimit(t *testing.T) {
+	root := t.TempDir()
+
+	writeTree(t, root, map[string]string{
+		"main.go":       "",
+		"a/a.go":        "",
+		"a/b/b.go":      "",
+		"a/b/c/c.go":    "",
+		"d/d.go":        "",
+		"vendor/x/x.go": "",
+	})
+
+	cfg := newTestConfig(root)
+	cfg.HoldGitOperations = false
+
+	testData := []struct {
+		backend string
+		limit   int
+		watched []string
+		polled  []string
+		err     bool
+	}{
+		{
+			// the directories closest to the root are watched first, the rest is polled
+			backend: watcher.BackendAuto,
+			limit:   3,
+			watched: []string{"", "a", "d"},
+			polled:  []string{"a/b", "a/b/c"},
+		},
+		{
+			backend: watcher.BackendAuto,
+			limit:   10,
+			watched: []string{"", "a", "d", "a/b", "a/b/c"},
+		},
+		{
+			// the fsnotify backend fails instead
+			backend: watcher.BackendFsnotify,
+			limit:   3,
+			err:     true,
+		},
+	}
+
+	for _, td := range testData {
+		preferred := newLimitedBackend(td.limit)
+
+		restore := watcher.SetNewBackend(func(kind string, pollInterval time.Duration) (watcher.Backend, error) {
+			if kind == watcher.BackendAuto {
+				return watcher.NewAutoBackendOver(preferred, pollInterval), nil
+			}
+
+			return preferred, nil
+		})
+
+		cfg.Backend = td.backend
+		w, err := watcher.New(newConfigs(t, cfg))
+
+		restore()
+
+		var limitErr *watcher.WatchLimitError
+
+		if td.err {
+			if !errors.As(err, &limitErr) {
+				t.Errorf("%s: expected a limit error got %v\n", td.backend, err)
+			} else if limitErr.Needed != 5 {
+				t.Errorf("%s: expected 5 needed directories got %d\n", td.backend, limitErr.Needed)
+			}
+
+			// the backend is released
+			if !preferred.closed {
+				t.Errorf("%s: expected the backend to be closed\n", td.backend)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var watched []string
+
+		for _, dir := range td.watched {
+			watched = append(watched, filepath.Join(root, filepath.FromSlash(dir)))
+		}
+
+		if !slices.Equal(preferred.watched, watched) {
+			t.Errorf("%s: expected watched %v got %v\n", td.backend, watched, preferred.watched)
+		}
+
+		polled := len(td.polled) > 0
+
+		if limitErr := w.LimitErr(); (limitErr != nil) != polled {
+			t.Errorf("%s: expected limit error %v got %v\n", td.backend, polled, limitErr)
+		} else if polled && (limitErr.Needed != 5 || limitErr.Watched != td.limit) {
+			t.Errorf("%s: expected %d watched out of 5 got %d out of %d\n", td.backend, td.limit, limitErr.Watched, limitErr.Needed)
+		}
+
+		w.Close()
+	}
+}
+
+func TestPrioritized(t *testing.T) {
+	// the missing package is not looked up in the module proxy
+	t.Setenv("GOPROXY", "off")
+
+	root := t.TempDir()
+
+	writeTree(t, root, map[string]string{
+		"go.mod":                "module example.com/app\n\ngo 1.22\n",
+		"main.go":               "package main\n\nimport (\n\t_ \"example.com/app/internal/api/v1\"\n\t_ \"example.com/app/web/gen\"\n)\n\nfunc main() {}\n",
+		"internal/api/v1/v1.go": "package v1\n",
+		"web/web.go":            "package web\n",
+		"web/static/a.go":       "package static\n",
+	})
+
+	testData := []struct {
+		watchDeps bool
+		paths     []string
+	}{
+		{
+			// the directories closest to the root first
+			watchDeps: false,
+			paths:     []string{"", "internal", "web", "internal/api", "web/static", "internal/api/v1"},
+		},
+		{
+			// the directories of the dependency closure first, then the parent of the missing web/gen package
+			watchDeps: true,
+			paths:     []string{"", "internal/api/v1", "web"},
+		},
+	}
+
+	for _, td := range testData {
+		cfg := newTestConfig(root)
+		cfg.WatchDeps = td.watchDeps
+
+		var paths []string
+
+		for _, dir := range td.paths {
+			paths = append(paths, filepath.Join(root, filepath.FromSlash(dir)))
+		}
+
+		if result := newConfigs(t, cfg).Prioritized(); !slices.Equal(result, paths) {
+			t.Errorf("watch deps %v: expected %v got %v\n", td.watchDeps, paths, result)
+		}
+	}
+}
+
+func TestFollowSymlinks(t *testing.T) {
+	tmp := t.TempDir()
+	root := filepath.Join(tmp, "app")
+
+	writeTree(t, tmp, map[string]string{
+		"app/main.go":            "package main",
+		"app/views/page.html":    "",
+		"shared/tpl/index.html":  "",
+		"shared/tpl/layout.html": "",
+	})
+
+	for link, target := range map[string]string{
+		"app/templates":   "../shared",
+		"app/aliases":     "views",
+		"shared/tpl/loop": "..",
+	} {
+		if err := os.Symlink(target, filepath.Join(tmp, filepath.FromSlash(link))); err != nil {
+			t.Skip("symbolic links are not supported:", err)
+		}
+	}
+
+	cfg := newTestConfig(root)
+	cfg.Delay = time.Millisecond * 10
+	cfg.FollowSymlinks = true
+
+	configs := newConfigs(t, cfg)
+
+	for _, dir := range []string{"templates", "templates/tpl"} {
+		if !slices.Contains(configs.Paths, filepath.Join(root, filepath.FromSlash(dir))) {
+			t.Errorf("expected linked directory %s to be watched\n", dir)
+		}
+	}
+
+	if dir := filepath.Join(root, "templates", "tpl", "loop"); slices.Contains(configs.Paths, dir) {
+		t.Errorf("expected link cycle %s not to be watched\n", dir)
+	}
+
+	// the link to a directory under the root is walked before it, the directory is still watched from it's real path
+	if dir := filepath.Join(root, "views"); !slices.Contains(configs.Paths, dir) {
+		t.Errorf("expected directory %s to be watched\n", dir)
+	}
+
+	if dir := filepath.Join(root, "aliases"); slices.Contains(configs.Paths, dir) {
+		t.Errorf("expected link %s to a directory under the root not to be watched\n", dir)
+	}
+
+	w, err := watcher.New(configs)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := make(chan watcher.Event, 1)
+
+	w.OnError(func(err error) { t.Error(err) })
+	w.OnEvent(watcher.WriteEvent, func(e watcher.Event) { events <- e })
+
+	go w.Listen(nil)
+	defer w.Close()
+
+	// edit the real file, the event is reported under the link
+	writeTree(t, tmp, map[string]string{"shared/tpl/index.html": "<html></html>"})
+
+	select {
+	case e := <-events:
+		if path := filepath.Join(root, "templates", "tpl", "index.html"); e.Path != path {
+			t.Errorf("expected event for %s got %s event for %s\n", path, e.Type, e.Path)
+		}
+
+	case <-time.After(time.Second):
+		t.Error("expected write event in linked directory")
+	}
+
+	writeTree(t, root, map[string]string{"views/page.html": "<html></html>"})
+
+	select {
+	case e := <-events:
+		if path := filepath.Join(root, "views", "page.html"); e.Path != path {
+			t.Errorf("expected event for %s got %s event for %s\n", path, e.Type, e.Path)
+		}
+
+	case <-time.After(time.Second):
+		t.Error("expected write event in directory under the root")
+	}
+}
+
+func TestEditorFiles(t *testing.T) {
+	root := t.TempDir()
+	cfg := newTestConfig(root)
+	cfg.Delay = time.Millisecond * 100
+	cfg.Include = []string{"**/*"}
+
+	writeTree(t, root, map[string]string{"main.go": "package main"})
+
+	configs := newConfigs(t, cfg)
+
+	testData := map[string]bool{
+		"main.go":                      true,
+		".main.go.swp":                 false,
+		".main.go.swx":                 false,
+		"4913":                         false,
+		".#main.go":                    false,
+		"#main.go#":                    false,
+		"main.go~":                     false,
+		"main.go___jb_tmp___":          false,
+		"internal/main.go___jb_old___": false,
+	}
+
+	for name, watched := range testData {
+		if result := configs.IsWatched(filepath.Join(root, filepath.FromSlash(name))); result != watched {
+			t.Errorf("%s: expected watched %v got %v\n", name, watched, result)
+		}
+	}
+
+	w, err := watcher.New(configs)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batches := make(chan watcher.Batch, 2)
+
+	w.OnError(func(err error) { t.Error(err) })
+	w.OnBatch(func(b watcher.Batch) { batches <- b })
+
+	go w.Listen(nil)
+	defer w.Close()
+
+	// save main.go like vim does, renaming it to a backup & writing a new file
+	path := filepath.Join(root, "main.go")
+
+	if err := os.Rename(path, path+"~"); err != nil {
+		t.Fatal(err)
+	}
+
+	writeTree(t, root, map[string]string{"4913": "", "main.go": "package main\n\nfunc main() {}\n"})
+
+	if err := os.Remove(path + "~"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case b := <-batches:
+		if len(b) != 1 || b[0].Path != path || b[0].Type.Has(watcher.RenameEvent) {
+			t.Errorf("expected a single write event for %s got %v\n", path, b)
+		}
+
+	case <-time.After(time.Second):
+		t.Error("expected write event for atomically saved file")
+	}
+
+	select {
+	case b := <-batches:
+		t.Errorf("expected a single batch got %v\n", b)
+
+	case <-time.After(time.Millisecond * 200):
+	}
+}
+
+func TestWatchFiles(t *testing.T) {
+	tmp := t.TempDir()
+	root := filepath.Join(tmp, "app")
+
+	writeTree(t, tmp, map[string]string{
+		"app/main.go":     "package main",
+		"app/Dockerfile":  "",
+		"app/go.mod":      "module example.com/app\n",
+		"app/notes":       "",
+		"config/.env":     "",
+		"config/main.go":  "package main",
+		"config/sub/a.go": "package sub",
+	})
+
+	cfg := newTestConfig(root)
+	cfg.Paths = []string{root, filepath.Join(tmp, "config", ".env")}
+	cfg.Include = []string{"Dockerfile", "go.mod"}
+
+	configs := newConfigs(t, cfg)
+
+	testData := map[string]bool{
+		"app/main.go":    true,
+		"app/Dockerfile": true,
+		"app/go.mod":     true,
+		"app/notes":      false,
+		"config/.env":    true,
+		"config/main.go": false,
+	}
+
+	for name, watched := range testData {
+		if result := configs.IsWatched(filepath.Join(tmp, filepath.FromSlash(name))); result != watched {
+			t.Errorf("%s: expected watched %v got %v\n", name, watched, result)
+		}
+	}
+
+	if dir := filepath.Join(tmp, "config", "sub"); slices.Contains(configs.Paths, dir) {
+		t.Errorf("expected %s not to be watched\n", dir)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	root := t.TempDir()
+
+	writeTree(t, root, map[string]string{
+		"main.go":      "package main",
+		"README.md":    "",
+		"bin/app.go":   "",
+		"Dockerfile":   "",
+		"gen/types.go": "",
+	})
+
+	cfg := newTestConfig(root)
+	cfg.Include = []string{"Dockerfile", "!gen/*.go"}
+
+	configs := newConfigs(t, cfg)
+
+	testData := []struct {
+		name    string
+		watched bool
+		rule    string
+	}{
+		{"main.go", true, ""},
+		{"README.md", false, ""},
+		{"bin", false, "bin (exclude)"},
+		{"bin/app.go", false, "bin (exclude)"},
+		{"Dockerfile", true, "Dockerfile (include)"},
+		{"gen/types.go", false, "!gen/*.go (include)"},
+	}
+
+	for _, td := range testData {
+		e := configs.Explain(filepath.Join(root, filepath.FromSlash(td.name)))
+
+		if e.Watched != td.watched {
+			t.Errorf("%s: expected watched %v got %v: %s\n", td.name, td.watched, e.Watched, e)
+		}
+
+		rule := ""
+
+		if e.Rule != nil {
+			rule = e.Rule.String()
+		}
+
+		if rule != td.rule {
+			t.Errorf("%s: expected rule %q got %q\n", td.name, td.rule, rule)
+		}
+	}
+}
+
+func TestTraceEvents(t *testing.T) {
+	root := t.TempDir()
+
+	w, err := watcher.New(newConfigs(t, newTestConfig(root)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decisions := make(map[string]string)
+
+	w.OnTrace(func(e watcher.Event, decision string) {
+		if _, ok := decisions[filepath.Base(e.Path)]; !ok {
+			decisions[filepath.Base(e.Path)] = decision
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go w.Run(ctx)
+
+	writeTree(t, root, map[string]string{"notes.txt": ""})
+	writeTree(t, root, map[string]string{"main.go": "package main"})
+
+	select {
+	case <-w.Events():
+	case <-time.After(time.Second):
+		t.Fatal("expected event for main.go")
+	}
+
+	cancel()
+
+	for range w.Events() {
+	}
+
+	if d := decisions["main.go"]; d != "dispatched" {
+		t.Errorf("expected main.go to be dispatched got %q\n", d)
+	}
+
+	if d := decisions["notes.txt"]; !strings.HasPrefix(d, "dropped") {
+		t.Errorf("expected notes.txt to be dropped got %q\n", d)
+	}
+}
+
+func TestTraceUnchangedContent(t *testing.T) {
+	root := t.TempDir()
+
+	writeTree(t, root, map[string]string{"main.go": "package main"})
+
+	cfg := newTestConfig(root)
+	cfg.Delay = time.Millisecond * 10
+
+	w, err := watcher.New(newConfigs(t, cfg))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		traces    = make(chan string, 10)
+		delivered = make(chan watcher.Batch, 1)
+	)
+
+	w.OnTrace(func(e watcher.Event, decision string) {
+		if filepath.Base(e.Path) == "main.go" {
+			traces <- decision
+		}
+	})
+
+	w.OnBatch(func(b watcher.Batch) { delivered <- b })
+
+	go w.Listen(nil)
+	defer w.Close()
+
+	// the content is the one primed when the watcher started
+	writeTree(t, root, map[string]string{"main.go": "package main"})
+
+	for deadline := time.After(time.Second); ; {
+		select {
+		case d := <-traces:
+			if d != "dropped, the content is unchanged since the last delivery" {
+				continue
+			}
+
+		case b := <-delivered:
+			t.Fatalf("expected no delivery got %v\n", b)
+
+		case <-deadline:
+			t.Fatal("expected the event to be traced as dropped for it's unchanged content")
+		}
+
+		break
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	var (
+		root    = t.TempDir()
+		session = filepath.Join(t.TempDir(), "session.jsonl")
+		start   time.Time
+	)
+
+	// the watcher is created again on config reloads, the session is appended to
+	for _, name := range []string{"main.go", "app.go"} {
+		configs := newConfigs(t, newTestConfig(root))
+		configs.RecordFile = session
+		configs.RecordStart = start
+
+		w, err := watcher.New(configs)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		start = configs.RecordStart
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		go w.Run(ctx)
+
+		writeTree(t, root, map[string]string{"notes.txt": "", name: "package main"})
+
+		select {
+		case <-w.Events():
+		case <-time.After(time.Second):
+			t.Fatalf("expected event for %s\n", name)
+		}
+
+		cancel()
+
+		for range w.Events() {
+		}
+	}
+
+	// replay the session in an empty directory, the recorded events are delivered without the files on disk
+	replayRoot := t.TempDir()
+	configs := newConfigs(t, newTestConfig(replayRoot))
+	configs.ReplayFile = session
+
+	w, err := watcher.New(configs)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go w.Run(ctx)
+
+	// a file can be recorded with a create & a write event, depending on the os delivering them
+	var (
+		expected = []string{filepath.Join(replayRoot, "app.go"), filepath.Join(replayRoot, "main.go")}
+		replayed []string
+		timeout  = time.After(time.Second * 2)
+	)
+
+	for len(replayed) < len(expected) {
+		select {
+		case e := <-w.Events():
+			if !slices.Contains(expected, e.Path) {
+				t.Errorf("expected replayed events for %v got %s event for %s\n", expected, e.Type, e.Path)
+			}
+
+			if !slices.Contains(replayed, e.Path) {
+				replayed = append(replayed, e.Path)
+			}
+
+		case <-timeout:
+			t.Fatalf("expected replayed events for %v got %v\n", expected, replayed)
+		}
+	}
+}
+
+func TestReplayState(t *testing.T) {
+	var (
+		root    = t.TempDir()
+		session = filepath.Join(t.TempDir(), "session.jsonl")
+	)
+
+	// the disk holds a different state than the recorded one
+	writeTree(t, root, map[string]string{"notes/main.go": "package main", "gone.go": "package main"})
+
+	records := strings.Join([]string{
+		`{"offset":0,"type":"CREATE","path":"pkg","kind":"dir"}`,
+		`{"offset":1000,"type":"CREATE","path":"pkg/a.go","kind":"file"}`,
+		`{"offset":2000,"type":"CREATE","path":"notes","kind":"missing"}`,
+		`{"offset":3000,"type":"WRITE","path":"gone.go","kind":"missing"}`,
+		`{"offset":4000,"type":"WRITE","path":"main.go","kind":"file"}`,
+	}, "\n")
+
+	if err := os.WriteFile(session, []byte(records), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	configs := newConfigs(t, newTestConfig(root))
+	configs.ReplayFile = session
+
+	w, err := watcher.New(configs)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go w.Run(ctx)
+
+	// the created directory holds a recorded watched file, the missing paths are dropped
+	for _, name := range []string{"pkg", "pkg/a.go", "main.go"} {
+		select {
+		case e := <-w.Events():
+			if path := filepath.Join(root, filepath.FromSlash(name)); e.Path != path {
+				t.Errorf("expected replayed event for %s got %s event for %s\n", path, e.Type, e.Path)
+			}
+
+		case <-time.After(time.Second):
+			t.Errorf("expected replayed event for %s\n", name)
+		}
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	root := t.TempDir()
+	cfg := newTestConfig(root)
+	cfg.Delay = time.Millisecond * 10
+
+	w, err := watcher.New(newConfigs(t, cfg))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batches := make(chan watcher.Batch, 2)
+
+	w.OnError(func(err error) { t.Error(err) })
+	w.OnBatch(func(b watcher.Batch) { batches <- b })
+
+	go w.Listen(nil)
+	defer w.Close()
+
+	w.Pause()
+
+	writeTree(t, root, map[string]string{"main.go": "package main"})
+	time.Sleep(time.Millisecond * 50)
+	writeTree(t, root, map[string]string{"util.go": "package main"})
+
+	select {
+	case b := <-batches:
+		t.Fatalf("expected no batch while paused got %v\n", b)
+
+	case <-time.After(time.Millisecond * 200):
+	}
+
+	w.Resume()
+
+	select {
+	case b := <-batches:
+		if paths := []string{filepath.Join(root, "main.go"), filepath.Join(root, "util.go")}; !slices.Equal(b.Paths(), paths) {
+			t.Errorf("expected a single batch for %v got %v\n", paths, b.Paths())
+		}
+
+	case <-time.After(time.Second):
+		t.Error("expected batch on resume")
+	}
+}
+
+func TestHoldGitOperations(t *testing.T) {
+	root := t.TempDir()
+	cfg := newTestConfig(root)
+	cfg.Delay = time.Millisecond * 10
+
+	if err := os.Mkdir(filepath.Join(root, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := watcher.New(newConfigs(t, cfg))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		lock    = filepath.Join(root, ".git", "index.lock")
+		batches = make(chan watcher.Batch, 2)
+	)
+
+	w.OnError(func(err error) { t.Error(err) })
+	w.OnBatch(func(b watcher.Batch) { batches <- b })
+
+	go w.Listen(nil)
+	defer w.Close()
+
+	writeTree(t, root, map[string]string{".git/index.lock": ""})
+	time.Sleep(time.Millisecond * 50)
+
+	if !w.GitOperationRunning() {
+		t.Fatal("expected the git operation to be running")
+	}
+
+	writeTree(t, root, map[string]string{"main.go": "package main"})
+	time.Sleep(time.Millisecond * 50)
+	writeTree(t, root, map[string]string{"util.go": "package main"})
+
+	select {
+	case b := <-batches:
+		t.Fatalf("expected no batch during the git operation got %v\n", b)
+
+	case <-time.After(time.Millisecond * 200):
+	}
+
+	if err := os.Remove(lock); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case b := <-batches:
+		if paths := []string{filepath.Join(root, "main.go"), filepath.Join(root, "util.go")}; !slices.Equal(b.Paths(), paths) {
+			t.Errorf("expected a single batch for %v got %v\n", paths, b.Paths())
+		}
+
+	case <-time.After(time.Second):
+		t.Fatal("expected batch once the git operation finished")
+	}
+
+	select {
+	case b := <-batches:
+		t.Errorf("expected a single batch got another %v\n", b)
+
+	case <-time.After(time.Millisecond * 200):
+	}
+}
+
+func TestStaleGitLock(t *testing.T) {
+	root := t.TempDir()
+	cfg := newTestConfig(root)
+	cfg.Delay = time.Millisecond * 10
+
+	if err := os.Mkdir(filepath.Join(root, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	configs := newConfigs(t, cfg)
+	configs.GitLockTimeout = time.Millisecond * 200
+
+	w, err := watcher.New(configs)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batches := make(chan watcher.Batch, 2)
+
+	w.OnError(func(err error) { t.Error(err) })
+	w.OnBatch(func(b watcher.Batch) { batches <- b })
+
+	go w.Listen(nil)
+	defer w.Close()
+
+	writeTree(t, root, map[string]string{".git/rebase-merge/head-name": "", ".git/index.lock": ""})
+	time.Sleep(time.Millisecond * 400)
+
+	if !w.GitOperationRunning() {
+		t.Fatal("expected the rebase to be running until it's state is removed")
+	}
+
+	if err := os.RemoveAll(filepath.Join(root, ".git", "rebase-merge")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the files keep changing past the lock timeout, like a long checkout
+	for i := range 8 {
+		writeTree(t, root, map[string]string{"main.go": fmt.Sprintf("package main // %d", i)})
+		time.Sleep(time.Millisecond * 50)
+
+		if !w.GitOperationRunning() {
+			t.Fatalf("expected the git operation to be running while the files change, %s after the lock\n", time.Duration(i+1)*time.Millisecond*50)
+		}
+	}
+
+	select {
+	case b := <-batches:
+		if paths := []string{filepath.Join(root, "main.go")}; !slices.Equal(b.Paths(), paths) {
+			t.Errorf("expected a batch for %v got %v\n", paths, b.Paths())
+		}
+
+		if w.GitOperationRunning() {
+			t.Error("expected the stale lock to be ignored")
+		}
+
+	case <-time.After(time.Second):
+		t.Fatal("expected batch once the lock is stale")
+	}
+}
+
+func TestGitSource(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	root := t.TempDir()
+
+	git := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = root
+
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s %s\n", args, err, out)
+		}
+	}
+
+	writeTree(t, root, map[string]string{
+		".gitignore":       "cache/\n*_gen.go\n",
+		"main.go":          "package main",
+		"util.go":          "package main",
+		"models_gen.go":    "package main",
+		"cache/big.go":     "package cache",
+		"cache/tracked.go": "package cache",
+	})
+
+	git("init", "-q")
+	git("add", ".gitignore", "main.go")
+	git("add", "--force", "cache/tracked.go")
+
+	cfg := newTestConfig(root)
+	cfg.Source = watcher.SourceGit
+	configs := newConfigs(t, cfg)
+
+	watched := map[string]bool{
+		"main.go":          true,
+		"util.go":          true,
+		"models_gen.go":    false,
+		"cache/big.go":     false,
+		"cache/tracked.go": true,
+	}
+
+	for name, expected := range watched {
+		if isWatched := configs.IsWatched(filepath.Join(root, filepath.FromSlash(name))); isWatched != expected {
+			t.Errorf("%s: expected watched to be %v got %v\n", name, expected, isWatched)
+		}
+	}
+
+	if !slices.Contains(configs.Paths, filepath.Join(root, "cache")) {
+		t.Errorf("expected the directory of the tracked file to be watched, got %v\n", configs.Paths)
+	}
+
+	w, err := watcher.New(configs)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w.OnError(func(err error) { t.Error(err) })
+
+	go w.Listen(nil)
+	defer w.Close()
+
+	// the watch set is refreshed when the index changes
+	git("add", "--force", "models_gen.go")
+
+	deadline := time.Now().Add(time.Second)
+
+	for !configs.IsWatched(filepath.Join(root, "models_gen.go")) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the newly tracked file to be watched")
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+}